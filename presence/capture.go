@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"example.com/presence/lib/fakediscord"
+	"example.com/presence/lib/ipc"
+)
+
+// startCapture records every IPC frame to path, appending, until the
+// returned stop is called. An empty path records nothing.
+func startCapture(path string) (stop func(), err error) {
+	if path == "" {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	ipc.SetRecorder(ipc.NewRecorder(f))
+	return func() {
+		ipc.SetRecorder(nil)
+		f.Close()
+	}, nil
+}
+
+// replayTimeout bounds the wait for each response during a replay.
+const replayTimeout = 5 * time.Second
+
+// replay sends the frames recs sent, in order, and prints what comes
+// back next to what came back when they were recorded. Every handshake
+// starts a new connection from dial, so a capture appended to by several
+// runs replays as several sessions. With realtime the original gaps
+// between frames are kept.
+func replay(dial func() (net.Conn, error), recs []ipc.Record, realtime bool) error {
+	var c net.Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	mismatches := 0
+	var last time.Time
+	for i, rec := range recs {
+		if rec.Dir != ipc.DirSend {
+			continue
+		}
+		if realtime && !last.IsZero() {
+			time.Sleep(rec.Time.Sub(last))
+		}
+		last = rec.Time
+
+		if rec.Opcode == ipc.OpHandshake || c == nil {
+			if c != nil {
+				c.Close()
+				fmt.Println("-- new session")
+			}
+			var err error
+			if c, err = dial(); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("> op %d %s\n", rec.Opcode, rec.Bytes())
+		if err := ipc.WriteFrame(c, rec.Opcode, rec.Bytes()); err != nil {
+			return err
+		}
+		if rec.Opcode == ipc.OpClose {
+			c.Close()
+			c = nil
+			continue
+		}
+
+		c.SetReadDeadline(time.Now().Add(replayTimeout))
+		op, resp, err := ipc.ReadFrame(c)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				fmt.Println("< no response")
+				continue
+			}
+			return err
+		}
+		fmt.Printf("< op %d %s\n", op, resp)
+
+		// compare with the first frame received after this one was sent
+		for _, want := range recs[i+1:] {
+			if want.Dir == ipc.DirSend {
+				break
+			}
+			if got, was := outcome(op, resp), outcome(want.Opcode, want.Bytes()); got != was {
+				mismatches++
+				fmt.Printf("! recorded %s, now %s\n", was, got)
+			}
+			break
+		}
+		if op == ipc.OpClose {
+			c.Close()
+			c = nil
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d responses differ from the capture", mismatches)
+	}
+	return nil
+}
+
+// outcome sums up a response for comparison: nonces and timestamps
+// differ between runs, acceptance or the error code should not.
+func outcome(opcode int, payload []byte) string {
+	var f struct {
+		Evt  string `json:"evt"`
+		Code int    `json:"code"`
+		Data struct {
+			Code int `json:"code"`
+		} `json:"data"`
+	}
+	json.Unmarshal(payload, &f)
+	switch {
+	case opcode == ipc.OpClose:
+		return fmt.Sprintf("close %d", f.Code)
+	case f.Evt == "ERROR":
+		return fmt.Sprintf("error %d", f.Data.Code)
+	case f.Evt != "":
+		return "event " + f.Evt
+	}
+	return fmt.Sprintf("op %d ok", opcode)
+}
+
+// replayTarget returns how to connect to where a replay goes: an
+// in-process fake Discord, or discord-ipc-n.
+func replayTarget(target string, n int) (func() (net.Conn, error), error) {
+	switch target {
+	case "fake":
+		srv := &fakediscord.Server{}
+		return func() (net.Conn, error) {
+			client, server := net.Pipe()
+			go srv.ServeConn(server)
+			return client, nil
+		}, nil
+	case "discord":
+		return func() (net.Conn, error) { return ipc.Dial(context.Background(), n) }, nil
+	}
+	return nil, fmt.Errorf("unknown target %q (want fake or discord)", target)
+}
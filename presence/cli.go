@@ -0,0 +1,733 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/control"
+	"example.com/presence/lib/ipc"
+	"example.com/presence/lib/monitor"
+	"example.com/presence/lib/stack"
+)
+
+const usage = `usage: presence <command> [flags]
+
+commands:
+  run      run the system-stats presence daemon (default)
+  set      set the presence from flags or a JSON file, over the daemon's
+           stats if one is running
+  clear    clear the presence, or remove a layer from the daemon's stack
+  status   show what the running daemon is doing
+  doctor   check socket discovery, handshake, client ID and asset keys
+  preview  print what would be published, after redaction
+  proxy    share one Discord connection between several local apps
+  replay   send the frames of a capture to a fake or the real Discord
+  unit     print or install a systemd user unit for the daemon
+
+Run "presence <command> -h" for the flags of a command.
+`
+
+// commands maps subcommand names to their implementation.
+var commands = map[string]func(args []string) error{
+	"run":     cmdRun,
+	"set":     cmdSet,
+	"clear":   cmdClear,
+	"status":  cmdStatus,
+	"doctor":  cmdDoctor,
+	"preview": cmdPreview,
+	"proxy":   cmdProxy,
+	"replay":  cmdReplay,
+	"unit":    cmdUnit,
+}
+
+// captureFlag adds -capture to a command that talks to Discord.
+func captureFlag(fs *flag.FlagSet) *string {
+	return fs.String("capture", "", "append every IPC frame to this JSONL file (default from config)")
+}
+
+// newFlagSet returns a flag set for cmd with the shared -config flag.
+func newFlagSet(cmd string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "path to the JSON config file")
+	return fs, configPath
+}
+
+func cmdRun(args []string) error {
+	fs, configPath := newFlagSet("run")
+	capture := captureFlag(fs)
+	page := fs.String("page", "", "page to show; if a daemon is already running, switch it to this page")
+	profile := fs.String("profile", "", "profile to use; if a daemon is already running, switch it to this profile")
+	fs.Parse(args)
+
+	release, err := lockInstance()
+	if errors.Is(err, errAlreadyRunning) {
+		return forwardRun(fs, *profile, *page)
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := setup(cfg); err != nil {
+		return err
+	}
+	stopCapture, err := startCapture(firstNonEmpty(*capture, cfg.Capture))
+	if err != nil {
+		return err
+	}
+	defer stopCapture()
+
+	out, _ := RunFastfetch(context.Background())
+	staticMap, staticDetails, _ := ParseFastfetch(out)
+	slog.Debug("static details", "text", staticDetails)
+
+	d, err := newDaemon(cfg, staticMap, staticDetails)
+	if err != nil {
+		return err
+	}
+	// the profile first: the page may be one of its own
+	if *profile != "" {
+		if err := d.SetProfile(*profile); err != nil {
+			return err
+		}
+	}
+	if *page != "" {
+		if err := d.SetPage(*page); err != nil {
+			return err
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// a second signal kills the process outright
+		stop()
+	}()
+	return d.run(ctx)
+}
+
+// forwardRun hands the flags of a second run over to the daemon already
+// running, or explains why this one is not starting.
+func forwardRun(fs *flag.FlagSet, profile, page string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	c := control.NewClient(controlPath())
+	st, err := c.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("%w, but its control API does not answer: %v", errAlreadyRunning, err)
+	}
+	if profile == "" && page == "" {
+		return fmt.Errorf("%w (pid %d), see presence status", errAlreadyRunning, st.PID)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "page" && f.Name != "profile" {
+			fmt.Fprintf(os.Stderr, "-%s only applies when the daemon starts, ignored\n", f.Name)
+		}
+	})
+	if profile != "" {
+		if err := c.SetProfile(ctx, profile); err != nil {
+			return err
+		}
+	}
+	if page != "" {
+		if err := c.SetPage(ctx, page); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("forwarded to the running daemon (pid %d)\n", st.PID)
+	return nil
+}
+
+func cmdPreview(args []string) error {
+	fs, configPath := newFlagSet("preview")
+	profile := fs.String("profile", defaultProfile, "profile to preview")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if cfg, err = cfg.withProfile(*profile); err != nil {
+		return err
+	}
+	out, _ := RunFastfetch(context.Background())
+	staticMap, staticDetails, _ := ParseFastfetch(out)
+	return preview(cfg, staticMap, staticDetails)
+}
+
+func cmdProxy(args []string) error {
+	fs, configPath := newFlagSet("proxy")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: presence proxy [flags]")
+		fmt.Fprintln(fs.Output(), "\nListens on discord-ipc-N for apps speaking the Discord IPC protocol and")
+		fmt.Fprintln(fs.Output(), "forwards one activity, picked or merged by policy, to the real Discord.")
+		fs.PrintDefaults()
+	}
+	listen := fs.Int("listen", -1, "N of the discord-ipc-N socket to serve (default from config)")
+	policy := fs.String("policy", "", "priority, latest or merge (default from config)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if *listen >= 0 {
+		cfg.Proxy.Listen = *listen
+	}
+	if *policy != "" {
+		cfg.Proxy.Policy = *policy
+	}
+	if err := setup(cfg); err != nil {
+		return err
+	}
+	p, err := newProxy(cfg)
+	if err != nil {
+		return err
+	}
+	ln, err := ipc.Listen(cfg.Proxy.Listen)
+	if err != nil {
+		return err
+	}
+	slog.Info("proxy listening", "socket", ipc.SocketPath(cfg.Proxy.Listen))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	err = p.Serve(ln)
+	p.Close()
+	return err
+}
+
+func cmdReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: presence replay [flags] capture.jsonl")
+		fmt.Fprintln(fs.Output(), "\nSends the frames recorded with -capture again, in order, and flags")
+		fmt.Fprintln(fs.Output(), "responses that differ from the recorded ones.")
+		fs.PrintDefaults()
+	}
+	target := fs.String("target", "fake", "fake (an in-process Discord stand-in) or discord")
+	socket := fs.Int("socket", 0, "N of the discord-ipc-N socket for -target discord")
+	realtime := fs.Bool("realtime", false, "keep the recorded gaps between frames")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	recs, err := ipc.ReadCapture(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	dial, err := replayTarget(*target, *socket)
+	if err != nil {
+		return err
+	}
+	return replay(dial, recs, *realtime)
+}
+
+// buttonFlags collects repeated -button "Label=URL" flags.
+type buttonFlags []control.Button
+
+func (b *buttonFlags) String() string { return fmt.Sprint(*b) }
+
+func (b *buttonFlags) Set(v string) error {
+	label, url, ok := strings.Cut(v, "=")
+	if !ok || label == "" || url == "" {
+		return errors.New(`want "Label=URL"`)
+	}
+	*b = append(*b, control.Button{Label: label, URL: url})
+	return nil
+}
+
+// specActivity validates s against Discord's limits and converts it.
+func specActivity(s control.Activity) (client.Activity, error) {
+	act := client.Activity{
+		Details:    s.Details,
+		State:      s.State,
+		LargeImage: s.LargeImage,
+		LargeText:  s.LargeText,
+		SmallImage: s.SmallImage,
+		SmallText:  s.SmallText,
+	}
+	if len(s.Buttons) > 2 {
+		return act, errors.New("at most 2 buttons are allowed")
+	}
+	for _, b := range s.Buttons {
+		act.Buttons = append(act.Buttons, &client.Button{Label: monitor.TruncateRunes(b.Label, monitor.ButtonMaxRunes), Url: b.URL})
+	}
+	for _, f := range []*string{&act.Details, &act.State, &act.LargeText, &act.SmallText} {
+		*f = monitor.TruncateRunes(*f, monitor.TextMaxRunes)
+	}
+	if s.Start != "" || s.End != "" {
+		act.Timestamps = &client.Timestamps{}
+		for _, t := range []struct {
+			spec string
+			dst  **time.Time
+		}{{s.Start, &act.Timestamps.Start}, {s.End, &act.Timestamps.End}} {
+			if t.spec == "" {
+				continue
+			}
+			v, err := parseTimeSpec(t.spec, time.Now())
+			if err != nil {
+				return act, err
+			}
+			*t.dst = &v
+		}
+	}
+	return act, nil
+}
+
+// parseTimeSpec accepts "now", "+1h30m" (relative to now), unix seconds or RFC 3339.
+func parseTimeSpec(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			return now.Add(d), nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time %q: want now, +duration, unix seconds or RFC 3339", s)
+	}
+	return t, nil
+}
+
+func cmdSet(args []string) error {
+	fs, configPath := newFlagSet("set")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: presence set [flags]")
+		fmt.Fprintln(fs.Output(), "\nWith a daemon running, set pushes a layer onto its activity stack, shown")
+		fmt.Fprintln(fs.Output(), "over the stats until -for has passed or `presence clear` removes it.")
+		fmt.Fprintln(fs.Output(), "\nWithout one it talks to Discord itself. Discord drops an activity when")
+		fmt.Fprintln(fs.Output(), "the connection that set it closes, so set then keeps running until")
+		fmt.Fprintln(fs.Output(), "interrupted or until -for has passed.")
+		fs.PrintDefaults()
+	}
+	var flagSpec control.Activity
+	var buttons buttonFlags
+	file := fs.String("file", "", "read the activity from a JSON file; other flags override it")
+	fs.StringVar(&flagSpec.Details, "details", "", "first line of the activity")
+	fs.StringVar(&flagSpec.State, "state", "", "second line of the activity")
+	fs.StringVar(&flagSpec.LargeImage, "large-image", "", "asset key or URL of the large image")
+	fs.StringVar(&flagSpec.LargeText, "large-text", "", "tooltip of the large image")
+	fs.StringVar(&flagSpec.SmallImage, "small-image", "", "asset key or URL of the small image")
+	fs.StringVar(&flagSpec.SmallText, "small-text", "", "tooltip of the small image")
+	fs.Var(&buttons, "button", `button as "Label=URL" (repeatable, at most 2)`)
+	fs.StringVar(&flagSpec.Start, "start", "", "elapsed timer start: now, +duration, unix seconds or RFC 3339")
+	fs.StringVar(&flagSpec.End, "end", "", "countdown end, same formats as -start")
+	clientIDFlag := fs.String("client-id", "", "Discord application ID (default from config)")
+	hold := fs.Duration("for", 0, "clear the presence after this long (default: until interrupted or cleared)")
+	source := fs.String("source", "cli", "stack layer to push when a daemon is running")
+	priority := fs.Int("priority", control.DefaultPriority, "priority of the stack layer")
+	capture := captureFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var spec control.Activity
+	if *file != "" {
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &spec); err != nil {
+			return fmt.Errorf("parse %s: %w", *file, err)
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "details":
+			spec.Details = flagSpec.Details
+		case "state":
+			spec.State = flagSpec.State
+		case "large-image":
+			spec.LargeImage = flagSpec.LargeImage
+		case "large-text":
+			spec.LargeText = flagSpec.LargeText
+		case "small-image":
+			spec.SmallImage = flagSpec.SmallImage
+		case "small-text":
+			spec.SmallText = flagSpec.SmallText
+		case "button":
+			spec.Buttons = buttons
+		case "start":
+			spec.Start = flagSpec.Start
+		case "end":
+			spec.End = flagSpec.End
+		}
+	})
+	act, err := specActivity(spec)
+	if err != nil {
+		return err
+	}
+
+	req := control.OverrideRequest{Source: *source, Priority: priority, Activity: &spec}
+	if *hold > 0 {
+		req.TTL = hold.String()
+	}
+	switch err := pushLayer(req); {
+	case err == nil:
+		warnStandalone(fs)
+		return nil
+	case !errors.Is(err, control.ErrNotRunning):
+		return err
+	}
+
+	if err := setup(cfg); err != nil {
+		return err
+	}
+	stopCapture, err := startCapture(firstNonEmpty(*capture, cfg.Capture))
+	if err != nil {
+		return err
+	}
+	defer stopCapture()
+	id := cfg.ClientID
+	if *clientIDFlag != "" {
+		id = *clientIDFlag
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := client.Login(reqCtx, id); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer client.Logout()
+	if err := client.SetActivity(reqCtx, act); err != nil {
+		return err
+	}
+
+	if *hold > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *hold)
+		defer cancel()
+	}
+	<-ctx.Done()
+	// ctx is done by now; clearing gets a budget of its own
+	clearCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return client.Shutdown(clearCtx)
+}
+
+// pushLayer hands req to the running daemon, if there is one.
+func pushLayer(req control.OverrideRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return control.NewClient(controlPath()).Override(ctx, req)
+}
+
+// warnStandalone names the flags given to set or clear that only apply
+// when they talk to Discord themselves; the daemon uses its own client
+// ID and capture file.
+func warnStandalone(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "client-id" || f.Name == "capture" {
+			fmt.Fprintf(os.Stderr, "-%s only applies without a running daemon, ignored\n", f.Name)
+		}
+	})
+}
+
+func cmdClear(args []string) error {
+	fs, configPath := newFlagSet("clear")
+	clientIDFlag := fs.String("client-id", "", "Discord application ID (default from config)")
+	source := fs.String("source", "cli", "stack layer to remove when a daemon is running")
+	capture := captureFlag(fs)
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	switch err := control.NewClient(controlPath()).ClearOverride(ctx, *source); {
+	case err == nil:
+		warnStandalone(fs)
+		return nil
+	case !errors.Is(err, control.ErrNotRunning):
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := setup(cfg); err != nil {
+		return err
+	}
+	stopCapture, err := startCapture(firstNonEmpty(*capture, cfg.Capture))
+	if err != nil {
+		return err
+	}
+	defer stopCapture()
+	id := cfg.ClientID
+	if *clientIDFlag != "" {
+		id = *clientIDFlag
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := client.Login(ctx, id); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer client.Logout()
+	return client.ClearActivity(ctx)
+}
+
+func cmdStatus(args []string) error {
+	// status only talks to the daemon, which has read its config already
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the raw status and metrics as JSON")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	c := control.NewClient(controlPath())
+	st, err := c.Status(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := c.Metrics(ctx)
+	if err != nil {
+		return err
+	}
+	layers, err := c.Stack(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Status  *control.Status  `json:"status"`
+			Metrics *control.Metrics `json:"metrics"`
+			Stack   []stack.Layer    `json:"stack"`
+		}{st, m, layers})
+	}
+
+	fmt.Printf("daemon running, pid %d, up %s\n", st.PID, time.Since(st.Started).Round(time.Second))
+	fmt.Println("connected:  ", st.Connected)
+	fmt.Println("paused:     ", st.Paused)
+	fmt.Println("away:       ", st.Away)
+	fmt.Printf("profile:     %s (of %s)\n", st.Profile, strings.Join(st.Profiles, ", "))
+	fmt.Printf("page:        %s (of %s)\n", st.Page, strings.Join(st.Pages, ", "))
+	if !st.LastUpdate.IsZero() {
+		fmt.Println("last update:", st.LastUpdate.Format(time.RFC3339))
+	}
+	if st.LastError != "" {
+		fmt.Println("last error: ", st.LastError)
+	}
+	fmt.Println("stack:")
+	for _, l := range layers {
+		mark := " "
+		if l.Source == st.Layer {
+			mark = "*"
+		}
+		what := "clear"
+		if l.Activity != nil {
+			what = strconv.Quote(l.Activity.Details)
+		}
+		until := ""
+		if !l.Expires.IsZero() {
+			until = "  until " + l.Expires.Format(time.RFC3339)
+		}
+		fmt.Printf("  %s %4d %-10s %s%s\n", mark, l.Priority, l.Source, what, until)
+	}
+	if st.Activity != nil {
+		fmt.Println("details:    ", st.Activity.Details)
+		fmt.Println("state:      ", st.Activity.State)
+	}
+	if !m.Sampled.IsZero() {
+		fmt.Printf("cpu %.1f%%  ram %.1f%%  net ↓ %s/s ↑ %s/s\n", m.Values[monitor.MetricCPU], m.Values[monitor.MetricRAM],
+			monitor.HumanBytes(uint64(m.Values[monitor.MetricNetRx])), monitor.HumanBytes(uint64(m.Values[monitor.MetricNetTx])))
+	}
+	return nil
+}
+
+// snowflakeRe matches a Discord ID.
+var snowflakeRe = regexp.MustCompile(`^[0-9]{17,20}$`)
+
+func cmdDoctor(args []string) error {
+	fs, configPath := newFlagSet("doctor")
+	profile := fs.String("profile", defaultProfile, "check the application and images of this profile")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if cfg, err = cfg.withProfile(*profile); err != nil {
+		return err
+	}
+
+	failed := false
+	check := func(ok bool, format string, a ...any) {
+		mark := "ok  "
+		if !ok {
+			mark = "FAIL"
+			failed = true
+		}
+		fmt.Printf("[%s] %s\n", mark, fmt.Sprintf(format, a...))
+	}
+
+	// socket discovery
+	fmt.Println("ipc directory:", ipc.GetIpcPath())
+	found := -1
+	for n := 0; n < 10; n++ {
+		if _, err := os.Stat(ipc.SocketPath(n)); err == nil {
+			fmt.Println("  found", ipc.SocketPath(n))
+			if found == -1 {
+				found = n
+			}
+		}
+	}
+	// the client tries discord-ipc-0 to discord-ipc-9 in turn, as
+	// Discord picks the next free one when several instances run
+	if found != -1 {
+		check(true, "discord-ipc-%d present", found)
+	} else {
+		check(false, "no discord-ipc-0 to discord-ipc-9 socket in %s", ipc.GetIpcPath())
+	}
+
+	// client ID
+	validID := snowflakeRe.MatchString(cfg.ClientID)
+	check(validID, "client ID %q looks like a Discord application ID", cfg.ClientID)
+
+	// handshake
+	if found != -1 && validID {
+		resp, err := doctorHandshake(cfg.ClientID)
+		check(err == nil, "handshake: %s", firstNonEmpty(errString(err), resp))
+	}
+
+	// asset keys
+	if validID {
+		keys := cfg.Images.keys()
+		missing, err := missingAssets(cfg.ClientID, keys)
+		switch {
+		case err != nil:
+			check(false, "asset lookup: %v", err)
+		case len(missing) > 0:
+			check(false, "assets missing from the application: %s", strings.Join(missing, ", "))
+		default:
+			check(true, "all %d asset keys exist", len(keys))
+		}
+	}
+
+	if failed {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
+
+// doctorHandshake performs a bare handshake and describes Discord's answer.
+func doctorHandshake(id string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := ipc.OpenSocket(ctx); err != nil {
+		return "", err
+	}
+	defer ipc.CloseSocket()
+	payload, err := json.Marshal(client.Handshake{V: 1, ClientId: id})
+	if err != nil {
+		return "", err
+	}
+	resp, err := ipc.Send(ctx, ipc.OpHandshake, string(payload))
+	if err != nil && !(errors.Is(err, ipc.ErrClosed) && resp != "") {
+		return "", err
+	}
+	// a CLOSE frame carries the reason of the rejection
+	var r struct {
+		Evt  string `json:"evt"`
+		Code int    `json:"code"`
+		Msg  string `json:"message"`
+		Data struct {
+			User struct {
+				Username string `json:"username"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp), &r); err != nil {
+		return "", fmt.Errorf("unreadable response %q", resp)
+	}
+	if r.Evt != "READY" {
+		return "", fmt.Errorf("rejected: %s (code %d)", r.Msg, r.Code)
+	}
+	return "READY as " + r.Data.User.Username, nil
+}
+
+// missingAssets lists the keys not uploaded as rich presence assets of the application.
+func missingAssets(id string, keys []string) ([]string, error) {
+	hc := &http.Client{Timeout: 5 * time.Second}
+	resp, err := hc.Get("https://discord.com/api/v10/oauth2/applications/" + id + "/assets")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var assets []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&assets); err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, a := range assets {
+		have[a.Name] = true
+	}
+	var missing []string
+	for _, k := range keys {
+		if !have[k] {
+			missing = append(missing, k)
+		}
+	}
+	return missing, nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
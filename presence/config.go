@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"example.com/presence/lib/ipc"
+	"example.com/presence/lib/monitor"
+	"example.com/presence/lib/redact"
+)
+
+// Config is the on-disk daemon configuration. Every field is optional;
+// anything left out keeps the value from defaultConfig.
+type Config struct {
+	ClientID     string                       `json:"client_id"`
+	PollInterval Duration                     `json:"poll_interval"`
+	Thresholds   map[string]monitor.Threshold `json:"thresholds"`
+	// Smoothing is the EWMA weight given to a new sample (0 < a <= 1).
+	// Zero disables smoothing.
+	Smoothing float64 `json:"smoothing"`
+	// SeriesLen is how many recent samples of each metric the sparkline
+	// template function can draw; zero means 32.
+	SeriesLen int               `json:"series_len"`
+	Templates monitor.Templates `json:"templates"`
+	// Pages are alternative template sets the daemon can be switched to,
+	// by name. Fields a page leaves empty come from Templates.
+	Pages   map[string]monitor.Templates `json:"pages"`
+	Network monitor.NetworkConfig        `json:"network"`
+	Paste   PasteConfig                  `json:"paste"`
+	Redact  RedactConfig                 `json:"redact"`
+	Report  ReportConfig                 `json:"report"`
+	Proxy   ProxyConfig                  `json:"proxy"`
+	// Capture is a JSONL file every IPC frame is appended to, for
+	// `presence replay`. Empty records nothing.
+	Capture string    `json:"capture"`
+	Log     LogConfig `json:"log"`
+	// MaxFrameSize bounds IPC frames read from Discord and, in the proxy,
+	// from clients; a peer announcing more is disconnected. Zero means
+	// the library default of 1 MiB.
+	MaxFrameSize int            `json:"max_frame_size"`
+	Metrics      MetricsConfig  `json:"metrics"`
+	History      HistoryConfig  `json:"history"`
+	Idle         IdleConfig     `json:"idle"`
+	Schedule     ScheduleConfig `json:"schedule"`
+	Images       ImageConfig    `json:"images"`
+	// ButtonURL is where the button leads instead of the uploaded report.
+	ButtonURL string `json:"button_url"`
+	// Providers are the metric providers to sample: cpu, memory and
+	// network. Nil means all of them.
+	Providers []string `json:"providers"`
+	// Profiles are named alternatives to the settings above, switched
+	// by `run -profile`, the control API or the schedule.
+	Profiles map[string]ProfileConfig `json:"profiles"`
+}
+
+// Duration is a time.Duration that reads and writes as "10s", "1m30s", ...
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// defaultConfig returns the settings a config file is decoded over. json
+// reuses the backing array of a slice it decodes into, so no slice here may
+// share one with a package-level default.
+func defaultConfig() Config {
+	return Config{
+		ClientID:     clientID,
+		PollInterval: Duration(pollInterval),
+		Thresholds: map[string]monitor.Threshold{
+			monitor.MetricCPU:   {Abs: cpuThresholdPct},
+			monitor.MetricRAM:   {Abs: memThresholdPct},
+			monitor.MetricNetRx: {Abs: netThresholdBytes, Rel: 0.25},
+			monitor.MetricNetTx: {Abs: netThresholdBytes, Rel: 0.25},
+		},
+		Templates: monitor.DefaultTemplates,
+		Images:    ImageConfig{Rules: slices.Clone(defaultImages.Rules), Large: defaultImages.Large, Small: defaultImages.Small},
+		Network:   monitor.NetworkConfig{Exclude: slices.Clone(monitor.DefaultNetExclude)},
+		Paste:     PasteConfig{Backend: "paste.rs", Timeout: Duration(pasteUploadTimeout)},
+		Redact:    RedactConfig{Builtins: slices.Clone(redact.Builtins)},
+		Proxy:     ProxyConfig{Listen: proxyListen, Upstream: proxyUpstream},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		History:   HistoryConfig{Format: "jsonl", RetentionDays: 30},
+		Idle:      IdleConfig{Action: "page", Page: awayPage, Sources: []string{"logind", "interrupts"}},
+	}
+}
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/presence/config.json (or the
+// platform equivalent), or an empty string if no config dir is known.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "presence", "config.json")
+}
+
+// loadConfig reads path on top of the defaults. A missing file is not an error.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.Smoothing < 0 || cfg.Smoothing > 1 {
+		return cfg, fmt.Errorf("parse %s: smoothing must be between 0 and 1", path)
+	}
+	if cfg.PollInterval <= 0 {
+		return cfg, fmt.Errorf("parse %s: poll_interval must be positive", path)
+	}
+	if cfg.SeriesLen < 0 || cfg.SeriesLen > monitor.TextMaxRunes {
+		return cfg, fmt.Errorf("parse %s: series_len must be between 0 and %d", path, monitor.TextMaxRunes)
+	}
+	if cfg.MaxFrameSize < 0 {
+		return cfg, fmt.Errorf("parse %s: max_frame_size must not be negative", path)
+	}
+	if _, err := cfg.Report.parse(); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.History.validate(); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Idle.validate(); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.validateProfiles(); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if _, err := cfg.Schedule.compile(); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// setup applies the process-wide parts of cfg: logging and IPC limits.
+func setup(cfg Config) error {
+	if err := setupLogging(cfg.Log); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	ipc.SetMaxFrameSize(cfg.MaxFrameSize)
+	return nil
+}
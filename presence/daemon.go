@@ -0,0 +1,623 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/control"
+	"example.com/presence/lib/history"
+	"example.com/presence/lib/monitor"
+	"example.com/presence/lib/paste"
+	"example.com/presence/lib/schedule"
+	"example.com/presence/lib/sdnotify"
+	"example.com/presence/lib/stack"
+)
+
+// defaultPage names the top-level templates.
+const defaultPage = "default"
+
+// monitorSource is the stack layer of the daemon's own stats, shown
+// whenever no higher priority layer is live.
+const (
+	monitorSource   = "monitor"
+	monitorPriority = 0
+)
+
+// daemon runs the stats monitor as the bottom layer of the activity
+// stack, shows whichever layer is on top, and serves the control API.
+// Sends to Discord go through publish, one at a time; everything the API
+// can read or change sits behind mu.
+type daemon struct {
+	cfg        Config // the top-level settings, whatever the profile
+	pasteCache *paste.Cache
+	history    *history.Store     // nil unless enabled
+	schedule   *schedule.Schedule // nil without entries
+	stack      *stack.Stack
+	metrics    *daemonMetrics
+	// notify reports to systemd; nil outside a notify unit
+	notify *sdnotify.Notifier
+
+	// wake asks the loop to re-render and publish without waiting for the
+	// next tick, after the API changed something
+	wake chan struct{}
+	// relogin asks the loop to move to the client ID of a new profile
+	relogin chan struct{}
+	// check is answered by the loop, so the watchdog can tell it from
+	// one stuck in a publish or a reconnect
+	check chan chan struct{}
+
+	// pubMu serializes publish between the loop and the monitor
+	pubMu sync.Mutex
+
+	mu sync.Mutex
+	// the profile in use: its presenter and monitor, and stopMon to end
+	// the monitor's Run when the next profile takes over
+	profile    string
+	clientID   string
+	pres       *presenter
+	mon        *monitor.Monitor
+	stopMon    context.CancelFunc
+	pasteURL   string
+	started    time.Time
+	connected  bool
+	paused     bool
+	away       bool
+	page       string
+	lastSent   *client.Activity
+	cleared    bool
+	showing    string
+	lastUpdate time.Time
+	lastError  string
+}
+
+func newDaemon(cfg Config, static map[string]string, staticDetails string) (*daemon, error) {
+	pres, err := newPresenter(cfg, static, staticDetails)
+	if err != nil {
+		return nil, err
+	}
+	// every profile parses now, so switching later does not fail on them
+	for name := range cfg.Profiles {
+		pcfg, _ := cfg.withProfile(name)
+		if _, err := newPresenter(pcfg, static, staticDetails); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	pc, err := newPasteCache(cfg.Paste)
+	if err != nil {
+		slog.Warn("paste disabled", "err", err)
+	}
+	sched, err := cfg.Schedule.compile()
+	if err != nil {
+		return nil, err
+	}
+	hist, err := openHistory(cfg.History)
+	if err != nil {
+		slog.Warn("history disabled", "err", err)
+	}
+	notify, err := sdnotify.New()
+	if err != nil {
+		slog.Warn("systemd notifications disabled", "err", err)
+	}
+	d := &daemon{
+		cfg:        cfg,
+		notify:     notify,
+		profile:    defaultProfile,
+		clientID:   cfg.ClientID,
+		pres:       pres,
+		pasteCache: pc,
+		history:    hist,
+		schedule:   sched,
+		stack:      stack.New(),
+		wake:       make(chan struct{}, 1),
+		relogin:    make(chan struct{}, 1),
+		check:      make(chan chan struct{}),
+		started:    time.Now(),
+		page:       defaultPage,
+	}
+	d.metrics = newDaemonMetrics(d)
+	if d.mon, err = pres.monitor(monitorLayer{d}, d.metrics, hist); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// monitorLayer is the monitor's client: it puts each activity into the
+// monitor layer and publishes the stack, so the stats only reach Discord
+// while no other layer covers them.
+type monitorLayer struct {
+	d *daemon
+}
+
+func (m monitorLayer) SetActivity(ctx context.Context, act client.Activity) error {
+	m.d.stack.Push(stack.Layer{Source: monitorSource, Priority: monitorPriority, Activity: &act})
+	return m.d.publish(ctx)
+}
+
+// run keeps the presence updated until ctx is done, then clears it.
+func (d *daemon) run(ctx context.Context) error {
+	if ln, err := listenControl(); err != nil {
+		slog.Warn("control API disabled", "err", err)
+	} else {
+		defer ln.Close()
+		handler := control.NewHandler(d)
+		if d.cfg.Metrics.Enabled || d.cfg.Metrics.Listen != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/", handler)
+			mux.Handle("GET /metrics", d.metrics.reg)
+			handler = mux
+		}
+		go func() {
+			if err := control.Serve(ln, handler); err != nil {
+				slog.Error("control API failed", "err", err)
+			}
+		}()
+	}
+	if addr := d.cfg.Metrics.Listen; addr != "" {
+		if ln, err := net.Listen("tcp", addr); err != nil {
+			slog.Warn("metrics listener disabled", "err", err)
+		} else {
+			defer ln.Close()
+			slog.Info("serving metrics", "addr", ln.Addr().String())
+			go serveMetrics(ln, d.metrics.reg)
+		}
+	}
+
+	// everything started below stops with ctx; cleaning up waits for it
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		d.shutdown()
+	}()
+
+	// upload paste for full fastfetch output (optional); the button is
+	// only attached once the upload has been confirmed
+	pasteReady := make(chan string, 1)
+	d.mu.Lock()
+	pres := d.pres
+	d.mu.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		text, err := pres.pasteText(ctx)
+		if err != nil {
+			slog.Error("report failed", "err", err)
+			pasteReady <- ""
+			return
+		}
+		url := uploadReport(ctx, d.pasteCache, time.Duration(d.cfg.Paste.Timeout), text)
+		switch {
+		case d.pasteCache == nil:
+		case url == "":
+			d.metrics.pasteUploads.Inc("failed")
+		default:
+			d.metrics.pasteUploads.Inc("ok")
+		}
+		pasteReady <- url
+	}()
+
+	// initial handshake/login
+	if err := d.login(ctx); err != nil {
+		if ctx.Err() != nil {
+			// stopped before Discord was reached
+			return nil
+		}
+		d.setError(err)
+		if errors.Is(err, client.ErrHandshakeRejected) {
+			return fmt.Errorf("check client_id: %w", err)
+		}
+		return fmt.Errorf("could not login after retries: %w", err)
+	}
+	slog.Info("logged in", "client_id", d.currentClientID())
+	d.notify.Notify(sdnotify.Ready)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.runMonitors(ctx)
+	}()
+	if d.schedule != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.runSchedule(ctx, d.schedule)
+		}()
+	}
+	if src := newIdleSource(d.cfg.Idle); src != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.watchIdle(ctx, src)
+		}()
+	}
+	if interval, ok := sdnotify.WatchdogInterval(); ok && d.notify != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.watchdog(ctx, interval)
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("shutting down")
+			return nil
+		case url := <-pasteReady:
+			d.mu.Lock()
+			d.pasteURL = url
+			if d.pres.cfg.ButtonURL == "" {
+				d.mon.SetButtonURL(url)
+			}
+			d.mu.Unlock()
+		case <-d.wake:
+			d.publish(ctx)
+		case <-d.relogin:
+			d.reconnect(ctx)
+		case done := <-d.check:
+			close(done)
+		}
+	}
+}
+
+// shutdown clears the presence, closes the connection and deletes the
+// superseded pastes still queued, giving up after shutdownTimeout so
+// neither Discord nor the paste service can hold up exit.
+func (d *daemon) shutdown() {
+	d.notify.Notify(sdnotify.Stopping)
+	defer d.notify.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != nil {
+		slog.Warn("clearing presence failed", "err", err)
+	}
+	if d.pasteCache != nil {
+		if err := d.pasteCache.Flush(ctx); err != nil {
+			slog.Warn("paste deletions left undone", "pending", d.pasteCache.Pending(), "err", err)
+		}
+	}
+	if d.history != nil {
+		if err := d.history.Close(); err != nil {
+			slog.Warn("closing history failed", "err", err)
+		}
+	}
+	slog.Info("stopped")
+}
+
+// watchdog pings systemd every interval for as long as both the monitor
+// loop and the main loop keep coming round. Either one stuck past the
+// unit's WatchdogSec gets the daemon restarted.
+func (d *daemon) watchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			loop, err := "monitor", d.monitor().Check(checkCtx)
+			if err == nil {
+				loop, err = "main", d.checkLoop(checkCtx)
+			}
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("loop is not answering, watchdog ping skipped", "loop", loop)
+				}
+				continue
+			}
+			d.notify.Notify(sdnotify.Watchdog)
+		}
+	}
+}
+
+// checkLoop waits for run to come round its loop, as Monitor.Check does
+// for the monitor. It fails if ctx is done first.
+func (d *daemon) checkLoop(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case d.check <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
+
+// reportStatus tells systemd what `systemctl status` should show.
+func (d *daemon) reportStatus() {
+	if d.notify == nil {
+		return
+	}
+	st := d.Status()
+	var s string
+	switch {
+	case !st.Connected:
+		s = "not connected to Discord"
+	case st.Paused:
+		s = "connected, paused"
+	default:
+		s = "connected"
+	}
+	if st.Profile != defaultProfile {
+		s += ", profile " + st.Profile
+	}
+	if st.Away {
+		s += ", away"
+	}
+	if st.Layer != "" && st.Layer != monitorSource {
+		s += ", showing " + st.Layer
+	}
+	if !st.LastUpdate.IsZero() {
+		s += ", last update " + st.LastUpdate.Local().Format(time.TimeOnly)
+	}
+	if st.LastError != "" {
+		s += "; " + st.LastError
+	}
+	d.notify.Status(s)
+}
+
+// poke wakes the loop; a wake-up already pending covers this one too.
+func (d *daemon) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// publish sends whatever the top of the stack holds, if Discord does not
+// have it yet. While paused the stack still changes but nothing is sent.
+func (d *daemon) publish(ctx context.Context) error {
+	d.pubMu.Lock()
+	defer d.pubMu.Unlock()
+	d.mu.Lock()
+	paused, lastSent, cleared := d.paused, d.lastSent, d.cleared
+	d.mu.Unlock()
+	if paused {
+		return nil
+	}
+
+	top, ok := d.stack.Top(time.Now())
+	if !ok {
+		if lastSent == nil {
+			// nothing sampled or pushed yet; the first tick will publish
+			return nil
+		}
+		// the last layer expired before the first sample came in
+		top = stack.Layer{}
+	}
+	if top.Activity == nil && cleared || top.Activity != nil && monitor.ActivityEqual(top.Activity, lastSent) {
+		d.mu.Lock()
+		d.showing = top.Source
+		d.mu.Unlock()
+		return nil
+	}
+
+	if err := d.send(ctx, top.Activity); err != nil {
+		d.setError(err)
+		d.reportStatus()
+		return err
+	}
+	d.mu.Lock()
+	d.lastSent = top.Activity
+	d.cleared = top.Activity == nil
+	d.showing = top.Source
+	d.lastUpdate = time.Now()
+	d.lastError = ""
+	d.mu.Unlock()
+	d.reportStatus()
+	return nil
+}
+
+// send sets act, or clears the activity if act is nil, giving Discord
+// requestTimeout to answer. If the connection is gone for good, or
+// Discord hung, it logs in from scratch and retries once.
+func (d *daemon) send(ctx context.Context, act *client.Activity) error {
+	set := func() error {
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		var err error
+		if act == nil {
+			err = client.ClearActivity(ctx)
+		} else {
+			err = client.SetActivity(ctx, *act)
+		}
+		d.metrics.countSetActivity(err)
+		return err
+	}
+	err := set()
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		// shutting down
+		return err
+	case errors.Is(err, client.ErrNotConnected), errors.Is(err, client.ErrClosed),
+		errors.Is(err, context.DeadlineExceeded):
+		slog.Warn("connection lost, reconnecting", "err", err)
+		client.Logout()
+		if err := d.login(ctx); err != nil {
+			slog.Error("reconnect attempts failed", "err", err)
+			d.metrics.reconnects.Inc("failed")
+			return err
+		}
+		d.metrics.reconnects.Inc("ok")
+		if err := set(); err != nil {
+			slog.Error("SetActivity retry failed", "err", err)
+			return err
+		}
+		return nil
+	default:
+		// not a connection problem, reconnecting would not help
+		slog.Error("SetActivity failed", "err", err)
+		return err
+	}
+}
+
+// login connects to Discord, backing off between attempts while it is
+// unreachable. A rejected handshake is not retried: the client ID will
+// not get any better.
+func (d *daemon) login(ctx context.Context) error {
+	var err error
+attempts:
+	for i := 0; i <= reconnectAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(reconnectBackoff * time.Duration(i)):
+			case <-ctx.Done():
+				err = ctx.Err()
+				break attempts
+			}
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		start := time.Now()
+		err = client.Login(attemptCtx, d.currentClientID())
+		cancel()
+		d.metrics.countHandshake(start, err)
+		if err == nil || errors.Is(err, client.ErrHandshakeRejected) || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("login failed", "attempt", i+1, "err", err)
+	}
+	d.mu.Lock()
+	d.connected = err == nil
+	d.mu.Unlock()
+	d.reportStatus()
+	return err
+}
+
+func (d *daemon) setError(err error) {
+	d.mu.Lock()
+	d.lastError = err.Error()
+	d.mu.Unlock()
+}
+
+// Status implements control.Controller.
+func (d *daemon) Status() control.Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := control.Status{
+		PID:        os.Getpid(),
+		Started:    d.started,
+		Connected:  d.connected,
+		Paused:     d.paused,
+		Away:       d.away,
+		Page:       d.page,
+		Pages:      d.pres.pageNames(),
+		Profile:    d.profile,
+		Profiles:   d.cfg.profileNames(),
+		LastUpdate: d.lastUpdate,
+		LastError:  d.lastError,
+		Layer:      d.showing,
+		Activity:   d.lastSent,
+	}
+	if err := d.mon.Snapshot().Err; st.LastError == "" && err != nil {
+		// sampling and rendering fail without reaching publish
+		st.LastError = err.Error()
+	}
+	return st
+}
+
+// Metrics implements control.Controller.
+func (d *daemon) Metrics() control.Metrics {
+	snap := d.monitor().Snapshot()
+	return control.Metrics{Sampled: snap.Sampled, Values: snap.Values, Shown: snap.Shown}
+}
+
+// reservedSource reports whether source names a layer the daemon pushes
+// itself, which the API may not replace or remove.
+func reservedSource(source string) bool {
+	return source == monitorSource || source == idleSource || source == scheduleSource
+}
+
+// Override implements control.Controller by pushing a stack layer.
+func (d *daemon) Override(req control.OverrideRequest) error {
+	l := stack.Layer{Source: req.Source, Priority: control.DefaultPriority}
+	if l.Source == "" {
+		l.Source = control.DefaultSource
+	}
+	if reservedSource(l.Source) {
+		return control.Invalidf("source %q is reserved", l.Source)
+	}
+	if req.Priority != nil {
+		l.Priority = *req.Priority
+	}
+	if req.Activity != nil {
+		act, err := specActivity(*req.Activity)
+		if err != nil {
+			return control.Invalidf("%v", err)
+		}
+		l.Activity = &act
+	}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return control.Invalidf("ttl %q: want a positive duration like 5m", req.TTL)
+		}
+		l.Expires = time.Now().Add(ttl)
+		// fall back to the layer below as soon as it expires
+		time.AfterFunc(ttl, d.poke)
+	}
+	d.stack.Push(l)
+	d.poke()
+	return nil
+}
+
+// ClearOverride implements control.Controller.
+func (d *daemon) ClearOverride(source string) error {
+	if reservedSource(source) {
+		return control.Invalidf("source %q is reserved", source)
+	}
+	if !d.stack.Remove(source) {
+		return fmt.Errorf("%w: no layer from %q", control.ErrNotFound, source)
+	}
+	d.poke()
+	return nil
+}
+
+// Stack implements control.Controller.
+func (d *daemon) Stack() []stack.Layer {
+	return d.stack.Layers(time.Now())
+}
+
+// Pause implements control.Controller. What is shown stays shown.
+func (d *daemon) Pause() {
+	d.mu.Lock()
+	d.paused = true
+	d.mu.Unlock()
+	d.reportStatus()
+}
+
+// Resume implements control.Controller.
+func (d *daemon) Resume() {
+	d.mu.Lock()
+	d.paused = false
+	d.mu.Unlock()
+	d.reportStatus()
+	d.poke()
+}
+
+// SetPage implements control.Controller.
+func (d *daemon) SetPage(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.pres.hasPage(name) {
+		return control.Invalidf("unknown page %q (have %v)", name, d.pres.pageNames())
+	}
+	// while away the away page stays up; coming back switches to this one
+	if !d.away || d.cfg.Idle.Action != "page" {
+		if err := d.mon.SetTemplates(d.pres.pages[name]); err != nil {
+			return err
+		}
+	}
+	d.page = name
+	return nil
+}
@@ -2,10 +2,12 @@ module example.com/presence
 
 go 1.24.0
 
-require gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce
+require (
+	github.com/shirou/gopsutil v3.21.11+incompatible
+	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce
+)
 
 require (
-	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
 	github.com/tklauser/go-sysconf v0.3.16 // indirect
 	github.com/tklauser/numcpus v0.11.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"example.com/presence/lib/history"
+)
+
+// HistoryConfig keeps every sample on disk, so templates can ask about
+// the past through .History, e.g. avg CPU
+// {{.History.Avg "cpu" "today" | printf "%.0f"}}% today.
+type HistoryConfig struct {
+	Enabled bool `json:"enabled"`
+	// Format is "jsonl", one file of JSON lines per day. SQLite would
+	// need a cgo or large third-party driver and is not built in.
+	Format string `json:"format"`
+	// Dir defaults to presence/history in the user cache directory.
+	Dir string `json:"dir"`
+	// RetentionDays is how many days, today included, are kept.
+	RetentionDays int `json:"retention_days"`
+}
+
+func (c HistoryConfig) validate() error {
+	switch c.Format {
+	case "", "jsonl":
+	case "sqlite":
+		return fmt.Errorf(`history format "sqlite" is not supported by this build; use "jsonl"`)
+	default:
+		return fmt.Errorf("unknown history format %q", c.Format)
+	}
+	if c.RetentionDays < 1 {
+		return fmt.Errorf("history retention_days must be at least 1")
+	}
+	return nil
+}
+
+// openHistory opens the configured store. It returns nil when history is
+// disabled.
+func openHistory(cfg HistoryConfig) (*history.Store, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(cache, "presence", "history")
+	}
+	return history.Open(dir, cfg.RetentionDays)
+}
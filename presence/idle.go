@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"example.com/presence/lib/idle"
+	"example.com/presence/lib/monitor"
+	"example.com/presence/lib/stack"
+)
+
+// IdleConfig changes the presence while nobody is at the machine.
+type IdleConfig struct {
+	// After is how long without input counts as away; zero turns idle
+	// detection off.
+	After Duration `json:"after"`
+	// Action is what happens then, until there is input again: "page"
+	// switches to Page, "clear" clears the activity and "pause" keeps
+	// what is shown without updating it.
+	Action string `json:"action"`
+	// Page is built in as "away" unless pages defines one by that name.
+	Page string `json:"page"`
+	// Sources are "logind" (the session's IdleHint) and "interrupts"
+	// (input device counters in /proc/interrupts); the user is away once
+	// any of them says so.
+	Sources []string `json:"sources"`
+	// Interrupts match the /proc/interrupts lines that count as input,
+	// by substring; empty means idle.DefaultInputIRQs.
+	Interrupts []string `json:"interrupts"`
+}
+
+const (
+	// awayPage is the built-in page for the "page" idle action.
+	awayPage = "away"
+	// idleSource is the stack layer of the "clear" and "pause" idle
+	// actions, above overrides at the default priority, so nothing
+	// pretends the user is there.
+	idleSource   = "idle"
+	idlePriority = 1000
+	// idlePoll is how often the idle sources are asked at most.
+	idlePoll = 5 * time.Second
+)
+
+// awayTemplates are the built-in away page; the rest comes from the
+// top-level templates.
+var awayTemplates = monitor.Templates{State: "Away", SmallText: "Away"}
+
+func (c IdleConfig) validate() error {
+	if c.After < 0 {
+		return fmt.Errorf("idle after must not be negative")
+	}
+	switch c.Action {
+	case "page", "clear", "pause":
+	default:
+		return fmt.Errorf("unknown idle action %q (want page, clear or pause)", c.Action)
+	}
+	if c.After > 0 && len(c.Sources) == 0 {
+		return fmt.Errorf("idle detection needs at least one source")
+	}
+	for _, s := range c.Sources {
+		if s != "logind" && s != "interrupts" {
+			return fmt.Errorf("unknown idle source %q (want logind or interrupts)", s)
+		}
+	}
+	return nil
+}
+
+// newIdleSource builds the configured detector. It returns nil when idle
+// detection is off.
+func newIdleSource(cfg IdleConfig) idle.Source {
+	if cfg.After <= 0 {
+		return nil
+	}
+	var sources []idle.Source
+	for _, s := range cfg.Sources {
+		switch s {
+		case "logind":
+			sources = append(sources, idle.Logind{})
+		case "interrupts":
+			sources = append(sources, &idle.Interrupts{Match: cfg.Interrupts})
+		}
+	}
+	return idle.Longest(sources...)
+}
+
+// watchIdle asks src how long the user has been idle until ctx is done,
+// and applies the idle action when that passes the threshold.
+func (d *daemon) watchIdle(ctx context.Context, src idle.Source) {
+	after := time.Duration(d.cfg.Idle.After)
+	ticker := time.NewTicker(max(min(after/2, idlePoll), time.Second))
+	defer ticker.Stop()
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		idleFor, err := src.Idle(ctx)
+		if err != nil {
+			// say so once, not on every poll
+			if !failing && ctx.Err() == nil {
+				slog.Warn("idle detection failed", "err", err)
+			}
+			failing = true
+			continue
+		}
+		failing = false
+		d.setAway(idleFor >= after, idleFor)
+	}
+}
+
+// setAway applies or undoes the idle action when away changes.
+func (d *daemon) setAway(away bool, idleFor time.Duration) {
+	d.mu.Lock()
+	if d.away == away {
+		d.mu.Unlock()
+		return
+	}
+	d.away = away
+	lastSent := d.lastSent
+	action := d.cfg.Idle.Action
+	if action == "page" {
+		// under mu, so SetPage cannot slip in between
+		name := d.page
+		if away {
+			name = d.cfg.Idle.Page
+		}
+		if err := d.mon.SetTemplates(d.pres.pages[name]); err != nil {
+			slog.Error("switching page failed", "page", name, "err", err)
+		}
+	}
+	d.mu.Unlock()
+
+	if away {
+		slog.Info("user away", "idle", idleFor.Round(time.Second), "action", action)
+	} else {
+		slog.Info("user back")
+	}
+	// SetTemplates above already asked the monitor for a fresh sample
+	if action == "clear" || action == "pause" {
+		if !away {
+			d.stack.Remove(idleSource)
+		} else {
+			l := stack.Layer{Source: idleSource, Priority: idlePriority}
+			if action == "pause" {
+				l.Activity = lastSent
+			}
+			d.stack.Push(l)
+		}
+		d.poke()
+	}
+	d.reportStatus()
+}
@@ -1,55 +1,154 @@
 package client
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"example.com/presence/lib/ipc"
 )
 
-var logged bool
+var (
+    logged   bool
+    clientID string
+)
 
-// login sends a handshake via IPC.
-func Login(clientid string) error {
-    if !logged {
-        payload, err := json.Marshal(Handshake{V: 1, ClientId: clientid})
-        if err != nil {
-            return err
-        }
-        if err = ipc.OpenSocket(); err != nil {
-            return err
-        }
-        resp, err := ipc.Send(0, string(payload))
-        if err != nil {
-            return fmt.Errorf("handshake send/read failed: %w (resp=%q)", err, resp)
-        }
-        fmt.Println("handshake response:", resp)
+var (
+    // ErrNotConnected is returned by calls made before Login, or after
+    // the connection was lost and could not be brought back.
+    ErrNotConnected = ipc.ErrNotConnected
+    // ErrClosed is returned when Discord closed the connection.
+    ErrClosed = ipc.ErrClosed
+    // ErrHandshakeRejected is returned by Login when Discord refuses the
+    // handshake, typically because the client ID is wrong.
+    ErrHandshakeRejected = errors.New("client: handshake rejected")
+    // ErrRateLimited matches a ResponseError saying the command came too
+    // soon after the previous ones.
+    ErrRateLimited = errors.New("client: rate limited")
+)
+
+// ResponseError is an ERROR event Discord answered a command with.
+type ResponseError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("discord: %s (code %d)", e.Message, e.Code)
+}
+
+// Is matches rate limit errors to ErrRateLimited. Discord documents no
+// code for them, so they are recognised by the message.
+func (e *ResponseError) Is(target error) bool {
+	return target == ErrRateLimited && strings.Contains(strings.ToLower(e.Message), "rate limit")
+}
+
+// responseError returns the ERROR event in resp, if it is one.
+func responseError(resp string) error {
+	var ev struct {
+		Evt  string `json:"evt"`
+		Data struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"data"`
+	}
+	if json.Unmarshal([]byte(resp), &ev) != nil || ev.Evt != "ERROR" {
+		return nil
+	}
+	return &ResponseError{Code: ev.Data.Code, Message: ev.Data.Message}
+}
+
+// login sends a handshake via IPC. ctx bounds the dial and the handshake.
+func Login(ctx context.Context, clientid string) error {
+    if logged {
         // DO NOT send handshake again
+        return nil
+    }
+    if err := handshake(ctx, clientid); err != nil {
+        return err
     }
     logged = true
+    clientID = clientid
+    return nil
+}
+
+// handshake opens the socket and expects READY in reply to the handshake.
+func handshake(ctx context.Context, clientid string) error {
+    payload, err := json.Marshal(Handshake{V: 1, ClientId: clientid})
+    if err != nil {
+        return err
+    }
+    if err = ipc.OpenSocket(ctx); err != nil {
+        return err
+    }
+    resp, err := ipc.Send(ctx, ipc.OpHandshake, string(payload))
+    if errors.Is(err, ipc.ErrClosed) && resp != "" {
+        // a CLOSE frame in reply carries Discord's reason
+        ipc.CloseSocket()
+        return fmt.Errorf("%w: %s", ErrHandshakeRejected, resp)
+    }
+    if err != nil {
+        ipc.CloseSocket()
+        return fmt.Errorf("handshake send/read failed: %w (resp=%q)", err, resp)
+    }
+    logger.Debug("handshake response", "payload", resp)
+    var ready struct {
+        Evt string `json:"evt"`
+    }
+    if json.Unmarshal([]byte(resp), &ready) != nil || ready.Evt != "READY" {
+        ipc.CloseSocket()
+        return fmt.Errorf("%w: %s", ErrHandshakeRejected, resp)
+    }
     return nil
 }
 
-func Logout() {
+// Logout closes the connection, which also clears the activity.
+func Logout() error {
 	logged = false
-	if err := ipc.CloseSocket(); err != nil {
-		panic(err)
+	return ipc.CloseSocket()
+}
+
+// Shutdown clears the activity and closes the connection with a CLOSE
+// frame, so Discord drops the presence at once instead of whenever it
+// notices the socket is gone. The socket is closed even if ctx runs out
+// first.
+func Shutdown(ctx context.Context) error {
+	if !logged {
+		return ipc.CloseSocket()
 	}
+	err := ClearActivity(ctx)
+	logged = false
+	return errors.Join(err, ipc.Close(ctx))
 }
 
-// SetActivity sends an activity update.
-func SetActivity(activity Activity) error {
+// SetActivity sends an activity update and waits for Discord to answer,
+// until ctx is done. A request cut short by ctx costs the connection,
+// and later calls return ErrNotConnected until the next Login.
+func SetActivity(ctx context.Context, activity Activity) error {
+    return setActivity(ctx, mapActivity(&activity))
+}
+
+// ClearActivity removes the activity set over this connection.
+func ClearActivity(ctx context.Context) error {
+	return setActivity(ctx, nil)
+}
+
+// setActivity sends SET_ACTIVITY. If Discord hung up, it logs in again
+// and retries once.
+func setActivity(ctx context.Context, activity *PayloadActivity) error {
     if !logged {
-        return nil
+        return ErrNotConnected
     }
 
     payload, err := json.Marshal(Frame{
         Cmd: "SET_ACTIVITY",
         Args: Args{
             Pid:      os.Getpid(),
-            Activity: mapActivity(&activity),
+            Activity: activity,
         },
         Nonce: getNonce(),
     })
@@ -57,27 +156,31 @@ func SetActivity(activity Activity) error {
         return err
     }
 
-    fmt.Println("SET_ACTIVITY payload:", string(payload))
+    logger.Debug("SET_ACTIVITY", "payload", string(payload))
 
     // First try
-    resp, err := ipc.Send(1, string(payload))
-    if err != nil {
-        fmt.Println("SET_ACTIVITY first send failed:", err, "resp:", resp)
-        // If broken pipe or connection dropped, try to reopen once
-        if err := ipc.CloseSocket(); err == nil {
-            if openErr := ipc.OpenSocket(); openErr == nil {
-                fmt.Println("reopened socket, retrying SET_ACTIVITY")
-                resp, err = ipc.Send(1, string(payload))
-            } else {
-                fmt.Println("failed to reopen socket:", openErr)
-            }
+    resp, err := ipc.Send(ctx, ipc.OpFrame, string(payload))
+    if errors.Is(err, ipc.ErrClosed) {
+        logger.Warn("SET_ACTIVITY send failed", "err", err, "resp", resp)
+        // broken pipe or connection dropped: log in again and retry once
+        ipc.CloseSocket()
+        if loginErr := handshake(ctx, clientID); loginErr != nil {
+            logger.Warn("failed to reopen socket", "err", loginErr)
+            logged = false
+            return fmt.Errorf("%w: reconnect failed: %w", ErrNotConnected, loginErr)
         }
+        logger.Info("reopened socket, retrying SET_ACTIVITY")
+        resp, err = ipc.Send(ctx, ipc.OpFrame, string(payload))
     }
     if err != nil {
+        if errors.Is(err, ipc.ErrClosed) || ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+            ipc.CloseSocket()
+            logged = false
+        }
         return fmt.Errorf("SET_ACTIVITY failed: %w (resp=%q)", err, resp)
     }
-    fmt.Println("SET_ACTIVITY response:", resp)
-    return nil
+    logger.Debug("SET_ACTIVITY response", "payload", resp)
+    return responseError(resp)
 }
 
 // getNonce creates a nonce string.
@@ -86,7 +189,7 @@ func getNonce() string {
 	var buf [16]byte
 	_, err := rand.Read(buf[:])
 	if err != nil {
-		fmt.Println("getNonce error:", err)
+		logger.Error("getNonce failed", "err", err)
 	}
 	buf[6] = (buf[6] & 0x0F) | 0x40
 	buf[8] = (buf[8] & 0x3F) | 0x80
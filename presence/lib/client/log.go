@@ -0,0 +1,14 @@
+package client
+
+import "log/slog"
+
+var logger = slog.New(slog.DiscardHandler)
+
+// SetLogger sends the package's logs to l. Nothing is logged until it
+// is called; nil silences the package again.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logger = l
+}
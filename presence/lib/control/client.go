@@ -0,0 +1,126 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"example.com/presence/lib/stack"
+)
+
+// ErrNotRunning is returned by Client calls when no daemon listens on the socket.
+var ErrNotRunning = errors.New("no daemon is running")
+
+// Client talks to a daemon's control socket.
+type Client struct {
+	hc *http.Client
+}
+
+// NewClient returns a client for the control socket at path.
+func NewClient(path string) *Client {
+	return &Client{hc: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+}
+
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var st Status
+	if err := c.do(ctx, http.MethodGet, "/v1/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (c *Client) Metrics(ctx context.Context) (*Metrics, error) {
+	var m Metrics
+	if err := c.do(ctx, http.MethodGet, "/v1/metrics", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (c *Client) Override(ctx context.Context, req OverrideRequest) error {
+	return c.do(ctx, http.MethodPost, "/v1/override", req, nil)
+}
+
+// ClearOverride removes the layer pushed by source.
+func (c *Client) ClearOverride(ctx context.Context, source string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/override?source="+url.QueryEscape(source), nil, nil)
+}
+
+func (c *Client) Stack(ctx context.Context) ([]stack.Layer, error) {
+	var layers []stack.Layer
+	if err := c.do(ctx, http.MethodGet, "/v1/stack", nil, &layers); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+func (c *Client) Pause(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/pause", nil, nil)
+}
+
+func (c *Client) Resume(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/resume", nil, nil)
+}
+
+func (c *Client) SetPage(ctx context.Context, page string) error {
+	return c.do(ctx, http.MethodPost, "/v1/page", PageRequest{Page: page}, nil)
+}
+
+func (c *Client) SetProfile(ctx context.Context, profile string) error {
+	return c.do(ctx, http.MethodPost, "/v1/profile", ProfileRequest{Profile: profile}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	// the host is ignored, the transport always dials the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://presence"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		// no socket, or a stale one nobody listens on; a timeout or a
+		// permission problem is not the same as no daemon
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return ErrNotRunning
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e apiError
+		if json.NewDecoder(io.LimitReader(resp.Body, maxBody)).Decode(&e) == nil && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("control: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
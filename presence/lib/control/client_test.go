@@ -0,0 +1,64 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotRunning(t *testing.T) {
+	dir := t.TempDir()
+
+	stale := filepath.Join(dir, "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep the file, as a daemon that crashed would
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	locked := filepath.Join(dir, "locked", "control.sock")
+	os.Mkdir(filepath.Dir(locked), 0o700)
+	if ln, err := net.Listen("unix", locked); err == nil {
+		defer ln.Close()
+	}
+	os.Chmod(filepath.Dir(locked), 0)
+	defer os.Chmod(filepath.Dir(locked), 0o700)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		path           string
+		wantNotRunning bool
+		skip           bool
+	}{
+		{"no socket", context.Background(), filepath.Join(dir, "missing.sock"), true, false},
+		{"stale socket", context.Background(), stale, true, false},
+		{"context done", cancelled, stale, false, false},
+		{"permission denied", context.Background(), locked, false, os.Geteuid() == 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.skip {
+				t.Skip("root is not denied")
+			}
+			ctx, cancel := context.WithTimeout(tt.ctx, time.Second)
+			defer cancel()
+			_, err := NewClient(tt.path).Status(ctx)
+			if err == nil {
+				t.Fatal("Status succeeded")
+			}
+			if got := errors.Is(err, ErrNotRunning); got != tt.wantNotRunning {
+				t.Errorf("Status error = %v; ErrNotRunning: %v, want %v", err, got, tt.wantNotRunning)
+			}
+		})
+	}
+}
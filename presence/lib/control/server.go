@@ -0,0 +1,164 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"example.com/presence/lib/stack"
+)
+
+// Controller is the part of the daemon the API drives.
+type Controller interface {
+	Status() Status
+	Metrics() Metrics
+	Override(req OverrideRequest) error
+	ClearOverride(source string) error
+	Stack() []stack.Layer
+	Pause()
+	Resume()
+	SetPage(name string) error
+	SetProfile(name string) error
+}
+
+// ErrInvalid marks errors caused by the request rather than the daemon;
+// the API answers them with 400.
+var ErrInvalid = errors.New("invalid request")
+
+// ErrNotFound is answered with 404.
+var ErrNotFound = errors.New("not found")
+
+// Invalidf returns an error wrapping ErrInvalid.
+func Invalidf(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// maxBody bounds request bodies.
+const maxBody = 64 << 10
+
+// NewHandler serves the control API:
+//
+//	GET    /v1/status    daemon and connection state
+//	GET    /v1/metrics   latest metric sample
+//	GET    /v1/stack     activity stack layers, the one shown first
+//	POST   /v1/override  push a stack layer, optionally with a TTL
+//	DELETE /v1/override  remove the layer of ?source= (default "control")
+//	POST   /v1/pause     stop sending updates
+//	POST   /v1/resume    start again
+//	POST   /v1/page      switch the page
+//	POST   /v1/profile   switch the profile
+func NewHandler(c Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+	mux.HandleFunc("GET /v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Metrics())
+	})
+	mux.HandleFunc("GET /v1/stack", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stack())
+	})
+	mux.HandleFunc("POST /v1/override", func(w http.ResponseWriter, r *http.Request) {
+		var req OverrideRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		reply(w, c.Override(req))
+	})
+	mux.HandleFunc("DELETE /v1/override", func(w http.ResponseWriter, r *http.Request) {
+		source := r.URL.Query().Get("source")
+		if source == "" {
+			source = DefaultSource
+		}
+		reply(w, c.ClearOverride(source))
+	})
+	mux.HandleFunc("POST /v1/pause", func(w http.ResponseWriter, r *http.Request) {
+		c.Pause()
+		reply(w, nil)
+	})
+	mux.HandleFunc("POST /v1/resume", func(w http.ResponseWriter, r *http.Request) {
+		c.Resume()
+		reply(w, nil)
+	})
+	mux.HandleFunc("POST /v1/page", func(w http.ResponseWriter, r *http.Request) {
+		var req PageRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		reply(w, c.SetPage(req.Page))
+	})
+	mux.HandleFunc("POST /v1/profile", func(w http.ResponseWriter, r *http.Request) {
+		var req ProfileRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		reply(w, c.SetProfile(req.Profile))
+	})
+	return mux
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "bad request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// reply answers 204 on success and maps err to a status otherwise.
+func reply(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrInvalid):
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+	case errors.Is(err, ErrNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Listen opens the unix socket at path, owner-only. A socket file left
+// behind by a dead daemon is replaced; one with a live daemon behind it
+// is an error.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve runs h, the API from NewHandler or a mux around it, on ln until
+// ln is closed.
+func Serve(ln net.Listener, h http.Handler) error {
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 5 * time.Second}
+	err := srv.Serve(ln)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
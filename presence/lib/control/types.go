@@ -0,0 +1,86 @@
+package control
+
+import (
+	"time"
+
+	"example.com/presence/lib/client"
+)
+
+// Activity is the JSON form of an activity accepted by the API and by
+// `presence set -file`. Start and End take "now", "+duration", unix
+// seconds or RFC 3339.
+type Activity struct {
+	Details    string   `json:"details,omitempty"`
+	State      string   `json:"state,omitempty"`
+	LargeImage string   `json:"large_image,omitempty"`
+	LargeText  string   `json:"large_text,omitempty"`
+	SmallImage string   `json:"small_image,omitempty"`
+	SmallText  string   `json:"small_text,omitempty"`
+	Buttons    []Button `json:"buttons,omitempty"`
+	Start      string   `json:"start,omitempty"`
+	End        string   `json:"end,omitempty"`
+}
+
+type Button struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// DefaultSource and DefaultPriority apply to override requests that do
+// not name their own. The daemon's own stats sit at priority 0.
+const (
+	DefaultSource   = "control"
+	DefaultPriority = 100
+)
+
+// OverrideRequest pushes a layer onto the daemon's activity stack,
+// replacing any earlier layer from the same source. A null Activity
+// clears the presence for as long as the layer is on top. TTL is a
+// duration like "5m"; without one the layer stays until removed.
+type OverrideRequest struct {
+	Source   string    `json:"source,omitempty"`
+	Priority *int      `json:"priority,omitempty"`
+	Activity *Activity `json:"activity"`
+	TTL      string    `json:"ttl,omitempty"`
+}
+
+// PageRequest switches the daemon to another page.
+type PageRequest struct {
+	Page string `json:"page"`
+}
+
+// ProfileRequest switches the daemon to another profile.
+type ProfileRequest struct {
+	Profile string `json:"profile"`
+}
+
+// Status is the daemon state returned by GET /v1/status.
+type Status struct {
+	PID        int       `json:"pid"`
+	Started    time.Time `json:"started"`
+	Connected  bool      `json:"connected"`
+	Paused     bool      `json:"paused"`
+	Away       bool      `json:"away"` // idle past the configured threshold
+	Page       string    `json:"page"`
+	Pages      []string  `json:"pages"`
+	Profile    string    `json:"profile"`
+	Profiles   []string  `json:"profiles"`
+	LastUpdate time.Time `json:"last_update,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	// Layer is the source of the stack layer being shown.
+	Layer    string           `json:"layer,omitempty"`
+	Activity *client.Activity `json:"activity,omitempty"`
+}
+
+// Metrics is the latest sample returned by GET /v1/metrics. Values are
+// the raw (smoothed) readings, Shown the ones behind the current activity.
+type Metrics struct {
+	Sampled time.Time          `json:"sampled"`
+	Values  map[string]float64 `json:"values"`
+	Shown   map[string]float64 `json:"shown"`
+}
+
+// apiError is the body of every non-2xx response.
+type apiError struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,332 @@
+// Package fakediscord is a stand-in for the Discord client's IPC server.
+// It checks handshakes and SET_ACTIVITY payloads the way Discord does and
+// answers with the same close codes and ERROR events, so rejections can
+// be reproduced without Discord running.
+package fakediscord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"example.com/presence/lib/ipc"
+)
+
+// Close codes sent with opcode 2, and error codes of ERROR events.
+const (
+	CloseInvalidClientID = 4000
+	CloseInvalidVersion  = 4004
+	CloseInvalidEncoding = 4005
+	CloseUnsupported     = 1003
+
+	ErrInvalidPayload = 4000
+	ErrInvalidCommand = 4002
+	ErrNotAuthorized  = 4006
+)
+
+// commands Discord knows but that need OAuth, which the fake does not do.
+var authCommands = map[string]bool{
+	"AUTHORIZE": true, "AUTHENTICATE": true, "GET_GUILD": true, "GET_GUILDS": true,
+	"GET_CHANNEL": true, "GET_CHANNELS": true, "SUBSCRIBE": true, "UNSUBSCRIBE": true,
+	"SET_USER_VOICE_SETTINGS": true, "SELECT_VOICE_CHANNEL": true,
+	"GET_SELECTED_VOICE_CHANNEL": true, "SELECT_TEXT_CHANNEL": true,
+	"GET_VOICE_SETTINGS": true, "SET_VOICE_SETTINGS": true,
+	"SEND_ACTIVITY_JOIN_INVITE": true, "CLOSE_ACTIVITY_REQUEST": true,
+}
+
+var snowflakeRe = regexp.MustCompile(`^[0-9]{17,20}$`)
+
+// Server accepts IPC connections. The zero value is ready to use.
+type Server struct {
+	// Logger, if set, receives handshakes and rejections, and every
+	// frame at debug level.
+	Logger *slog.Logger
+	// MaxFrameSize bounds the frames accepted, ipc.DefaultMaxFrameSize
+	// if zero.
+	MaxFrameSize int
+
+	mu       sync.Mutex
+	activity json.RawMessage
+}
+
+// Activity returns the last activity accepted, nil if none or cleared.
+func (s *Server) Activity() json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activity
+}
+
+// Serve accepts connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn speaks the protocol on c until either side closes it.
+func (s *Server) ServeConn(c net.Conn) {
+	defer c.Close()
+
+	dec := ipc.NewDecoder(c, s.MaxFrameSize)
+	op, payload, err := dec.Decode()
+	var hs struct {
+		V        *int   `json:"v"`
+		ClientID string `json:"client_id"`
+	}
+	switch {
+	case errors.Is(err, ipc.ErrBadPayload):
+		s.close(c, CloseInvalidEncoding, "Invalid Encoding")
+		return
+	case errors.Is(err, ipc.ErrFrameTooLarge), errors.Is(err, ipc.ErrBadOpcode):
+		s.close(c, CloseUnsupported, err.Error())
+		return
+	case err != nil:
+		return
+	case op != ipc.OpHandshake:
+		s.close(c, CloseUnsupported, fmt.Sprintf("expected a handshake, got opcode %d", op))
+		return
+	case json.Unmarshal(payload, &hs) != nil:
+		s.close(c, CloseInvalidEncoding, "Invalid Encoding")
+		return
+	case hs.V == nil || *hs.V != 1:
+		s.close(c, CloseInvalidVersion, "Invalid Version")
+		return
+	case !snowflakeRe.MatchString(hs.ClientID):
+		s.close(c, CloseInvalidClientID, "Invalid Client ID")
+		return
+	}
+	s.log().Info("handshake", "client_id", hs.ClientID)
+	ready := map[string]any{
+		"cmd": "DISPATCH", "evt": "READY", "nonce": nil,
+		"data": map[string]any{
+			"v": 1,
+			"config": map[string]any{
+				"cdn_host":     "cdn.discordapp.com",
+				"api_endpoint": "//discord.com/api",
+				"environment":  "production",
+			},
+			"user": map[string]any{
+				"id": "100000000000000000", "username": "fake", "discriminator": "0",
+				"global_name": "Fake", "avatar": nil, "bot": false, "flags": 0, "premium_type": 0,
+			},
+		},
+	}
+	if s.write(c, ipc.OpFrame, ready) != nil {
+		return
+	}
+
+	for {
+		op, payload, err := dec.Decode()
+		switch {
+		case errors.Is(err, ipc.ErrBadPayload):
+			// the frame boundary held; answer like any bad command
+			if s.write(c, ipc.OpFrame, errorEvent("", nil, ErrInvalidPayload, "Payload must be valid JSON")) != nil {
+				return
+			}
+			continue
+		case errors.Is(err, ipc.ErrFrameTooLarge), errors.Is(err, ipc.ErrBadOpcode):
+			s.close(c, CloseUnsupported, err.Error())
+			return
+		case err != nil:
+			return
+		}
+		s.log().Debug("frame received", "op", op, "payload", string(payload))
+		switch op {
+		case ipc.OpPing:
+			if ipc.WriteFrame(c, ipc.OpPong, payload) != nil {
+				return
+			}
+		case ipc.OpClose:
+			s.setActivity(nil)
+			return
+		case ipc.OpFrame:
+			if s.write(c, ipc.OpFrame, s.command(hs.ClientID, payload)) != nil {
+				return
+			}
+		default:
+			s.close(c, CloseUnsupported, fmt.Sprintf("unexpected opcode %d", op))
+			return
+		}
+	}
+}
+
+// command returns the response to one opcode 1 payload.
+func (s *Server) command(clientID string, payload []byte) map[string]any {
+	var f struct {
+		Cmd   string          `json:"cmd"`
+		Args  json.RawMessage `json:"args"`
+		Nonce *string         `json:"nonce"`
+	}
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return errorEvent("", nil, ErrInvalidPayload, "Payload must be a JSON object")
+	}
+	switch {
+	case f.Cmd == "":
+		return errorEvent("", f.Nonce, ErrInvalidCommand, `child "cmd" fails because ["cmd" is required]`)
+	case f.Nonce == nil:
+		return errorEvent(f.Cmd, nil, ErrInvalidPayload, `child "nonce" fails because ["nonce" is required]`)
+	case authCommands[f.Cmd]:
+		return errorEvent(f.Cmd, f.Nonce, ErrNotAuthorized, "Not authenticated or invalid scope")
+	case f.Cmd != "SET_ACTIVITY":
+		return errorEvent(f.Cmd, f.Nonce, ErrInvalidCommand, "Invalid command: "+f.Cmd)
+	}
+
+	var args struct {
+		Pid      *int            `json:"pid"`
+		Activity json.RawMessage `json:"activity"`
+	}
+	if err := json.Unmarshal(f.Args, &args); err != nil || len(f.Args) == 0 {
+		return errorEvent(f.Cmd, f.Nonce, ErrInvalidPayload, `child "args" fails because ["args" must be an object]`)
+	}
+	if args.Pid == nil {
+		return errorEvent(f.Cmd, f.Nonce, ErrInvalidPayload, `child "pid" fails because ["pid" is required]`)
+	}
+	if len(args.Activity) == 0 || string(args.Activity) == "null" {
+		s.setActivity(nil)
+		return map[string]any{"cmd": f.Cmd, "evt": nil, "nonce": *f.Nonce, "data": nil}
+	}
+	act, err := checkActivity(args.Activity)
+	if err != nil {
+		return errorEvent(f.Cmd, f.Nonce, ErrInvalidPayload, `child "activity" fails because [`+err.Error()+`]`)
+	}
+	s.setActivity(args.Activity)
+
+	// Discord echoes the activity with the fields it fills in itself
+	act["application_id"] = clientID
+	act["name"] = "fake"
+	act["type"] = 0
+	act["metadata"] = map[string]any{}
+	return map[string]any{"cmd": f.Cmd, "evt": nil, "nonce": *f.Nonce, "data": act}
+}
+
+// checkActivity applies Discord's limits to an activity.
+func checkActivity(raw json.RawMessage) (map[string]any, error) {
+	var act map[string]any
+	if err := json.Unmarshal(raw, &act); err != nil {
+		return nil, errors.New(`"activity" must be an object`)
+	}
+	for _, k := range []string{"details", "state"} {
+		if err := checkText(act, k, 2, 128); err != nil {
+			return nil, err
+		}
+	}
+	if assets, ok := act["assets"].(map[string]any); ok {
+		for _, k := range []string{"large_text", "small_text"} {
+			if err := checkText(assets, k, 2, 128); err != nil {
+				return nil, fmt.Errorf(`child "assets" fails because [%w]`, err)
+			}
+		}
+	}
+	if ts, ok := act["timestamps"].(map[string]any); ok {
+		for _, k := range []string{"start", "end"} {
+			if v, ok := ts[k]; ok {
+				if n, ok := v.(float64); !ok || n < 0 || n != float64(int64(n)) {
+					return nil, fmt.Errorf(`child "timestamps" fails because [child %q fails because [%q must be a positive integer]]`, k, k)
+				}
+			}
+		}
+	}
+	if v, ok := act["buttons"]; ok {
+		buttons, ok := v.([]any)
+		if !ok {
+			return nil, errors.New(`child "buttons" fails because ["buttons" must be an array]`)
+		}
+		if len(buttons) > 2 {
+			return nil, errors.New(`child "buttons" fails because ["buttons" must contain less than or equal to 2 items]`)
+		}
+		for i, b := range buttons {
+			bm, ok := b.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf(`child "buttons" fails because ["%d" must be an object]`, i)
+			}
+			if err := required(bm, "label", 1, 32); err != nil {
+				return nil, fmt.Errorf(`child "buttons" fails because [%w]`, err)
+			}
+			if err := required(bm, "url", 1, 512); err != nil {
+				return nil, fmt.Errorf(`child "buttons" fails because [%w]`, err)
+			}
+		}
+		if _, ok := act["secrets"]; ok && len(buttons) > 0 {
+			return nil, errors.New(`"buttons" cannot be used with "secrets"`)
+		}
+	}
+	return act, nil
+}
+
+// checkText checks an optional string field's length in runes.
+func checkText(m map[string]any, k string, min, max int) error {
+	v, ok := m[k]
+	if !ok {
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(`child %q fails because [%q must be a string]`, k, k)
+	}
+	n := utf8.RuneCountInString(s)
+	if n < min {
+		return fmt.Errorf(`child %q fails because [%q length must be at least %d characters long]`, k, k, min)
+	}
+	if n > max {
+		return fmt.Errorf(`child %q fails because [%q length must be less than or equal to %d characters long]`, k, k, max)
+	}
+	return nil
+}
+
+func required(m map[string]any, k string, min, max int) error {
+	if _, ok := m[k]; !ok {
+		return fmt.Errorf(`child %q fails because [%q is required]`, k, k)
+	}
+	return checkText(m, k, min, max)
+}
+
+func errorEvent(cmd string, nonce *string, code int, message string) map[string]any {
+	ev := map[string]any{
+		"cmd": cmd, "evt": "ERROR", "nonce": nil,
+		"data": map[string]any{"code": code, "message": message},
+	}
+	if nonce != nil {
+		ev["nonce"] = *nonce
+	}
+	return ev
+}
+
+func (s *Server) setActivity(act json.RawMessage) {
+	s.mu.Lock()
+	s.activity = act
+	s.mu.Unlock()
+}
+
+func (s *Server) write(c net.Conn, opcode int, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.log().Debug("frame sent", "op", opcode, "payload", string(b))
+	return ipc.WriteFrame(c, opcode, b)
+}
+
+// close rejects the connection the way Discord does, with a CLOSE frame.
+func (s *Server) close(c net.Conn, code int, message string) {
+	s.log().Info("closing connection", "code", code, "message", message)
+	s.write(c, ipc.OpClose, map[string]any{"code": code, "message": message})
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return s.Logger
+}
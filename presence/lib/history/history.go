@@ -0,0 +1,301 @@
+// Package history keeps metric samples as JSON lines, one file per local
+// day, deletes the files that fall out of retention, and answers
+// questions about them: rolling averages, peaks and daily streaks.
+//
+// Queries are answered from minute buckets kept in memory, rebuilt from
+// the files on Open, so a store costs a few bytes per metric and minute
+// of retention rather than per sample.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dayLayout names the daily files: 2006-01-02.jsonl.
+const dayLayout = "2006-01-02"
+
+// Record is one line of a history file.
+type Record struct {
+	Time   time.Time          `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// bucket aggregates the samples of one minute.
+type bucket struct {
+	n   map[string]int
+	sum map[string]float64
+	max map[string]float64
+}
+
+// Store appends samples to the file of their day and queries them.
+type Store struct {
+	dir       string
+	retention int
+	loc       *time.Location
+
+	mu      sync.Mutex
+	f       *os.File
+	fileDay string
+	buckets map[int64]*bucket // by unix minute
+	days    map[string]bool   // days with at least one sample
+	now     func() time.Time
+}
+
+// Open opens the history in dir, keeping retentionDays days including
+// today, and loads what is there. Days are local days.
+func Open(dir string, retentionDays int) (*Store, error) {
+	if retentionDays < 1 {
+		return nil, fmt.Errorf("history: retention must be at least one day, got %d", retentionDays)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:       dir,
+		retention: retentionDays,
+		loc:       time.Local,
+		buckets:   map[int64]*bucket{},
+		days:      map[string]bool{},
+		now:       time.Now,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append records vals as sampled at t.
+func (s *Store) Append(t time.Time, vals map[string]float64) error {
+	line, err := json.Marshal(Record{Time: t, Values: vals})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := t.In(s.loc).Format(dayLayout)
+	if s.f == nil || day != s.fileDay {
+		if err := s.rotate(day); err != nil {
+			return err
+		}
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.add(t, vals)
+	return nil
+}
+
+// Close closes the current file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// rotate switches to the file of day and applies retention.
+func (s *Store) rotate(day string) error {
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, day+".jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.f, s.fileDay = f, day
+	return s.expire()
+}
+
+// cutoff is the start of the oldest day still retained.
+func (s *Store) cutoff() time.Time {
+	y, m, d := s.now().In(s.loc).Date()
+	return time.Date(y, m, d-(s.retention-1), 0, 0, 0, 0, s.loc)
+}
+
+// expire deletes the files and buckets older than the retention.
+func (s *Store) expire() error {
+	cutoff := s.cutoff()
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, day := range files {
+		if t, _ := time.ParseInLocation(dayLayout, day, s.loc); t.Before(cutoff) {
+			if err := os.Remove(filepath.Join(s.dir, day+".jsonl")); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			delete(s.days, day)
+		}
+	}
+	for min := range s.buckets {
+		if time.Unix(min*60, 0).Before(cutoff) {
+			delete(s.buckets, min)
+		}
+	}
+	return nil
+}
+
+// files returns the days that have a file, oldest first.
+func (s *Store) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, e := range entries {
+		day, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if _, err := time.Parse(dayLayout, day); ok && err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// load reads every retained file into the buckets. Lines that do not
+// parse, say the torn last line of a crash, are skipped.
+func (s *Store) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return err
+	}
+	days, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		f, err := os.Open(filepath.Join(s.dir, day+".jsonl"))
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			var r Record
+			if json.Unmarshal(sc.Bytes(), &r) == nil && !r.Time.IsZero() {
+				s.add(r.Time, r.Values)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return fmt.Errorf("history: read %s: %w", day, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) add(t time.Time, vals map[string]float64) {
+	min := t.Unix() / 60
+	b, ok := s.buckets[min]
+	if !ok {
+		b = &bucket{n: map[string]int{}, sum: map[string]float64{}, max: map[string]float64{}}
+		s.buckets[min] = b
+	}
+	for k, v := range vals {
+		if b.n[k] == 0 || v > b.max[k] {
+			b.max[k] = v
+		}
+		b.n[k]++
+		b.sum[k] += v
+	}
+	s.days[t.In(s.loc).Format(dayLayout)] = true
+}
+
+// Avg returns the mean of metric over window: "today", "yesterday", or
+// a span back from now such as "1h", "24h" or "7d".
+func (s *Store) Avg(metric, window string) (float64, error) {
+	from, to, err := s.window(window)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	var sum float64
+	for min, b := range s.buckets {
+		if t := time.Unix(min*60, 0); !t.Before(from) && t.Before(to) {
+			n += b.n[metric]
+			sum += b.sum[metric]
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return sum / float64(n), nil
+}
+
+// Peak returns the highest value of metric over window, as for Avg.
+func (s *Store) Peak(metric, window string) (float64, error) {
+	from, to, err := s.window(window)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var peak float64
+	seen := false
+	for min, b := range s.buckets {
+		if t := time.Unix(min*60, 0); !t.Before(from) && t.Before(to) && b.n[metric] > 0 {
+			if !seen || b.max[metric] > peak {
+				peak = b.max[metric]
+			}
+			seen = true
+		}
+	}
+	return peak, nil
+}
+
+// Streak returns the number of consecutive days, ending today, with at
+// least one sample: how many days in a row the daemon has been up.
+func (s *Store) Streak() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	y, m, d := s.now().In(s.loc).Date()
+	n := 0
+	for s.days[time.Date(y, m, d-n, 0, 0, 0, 0, s.loc).Format(dayLayout)] {
+		n++
+	}
+	return n
+}
+
+// window resolves a window name to [from, to).
+func (s *Store) window(w string) (from, to time.Time, err error) {
+	now := s.now().In(s.loc)
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, s.loc)
+	// the current minute's bucket starts before now
+	to = now.Add(time.Minute)
+	switch w {
+	case "today":
+		return midnight, to, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, nil
+	}
+	var span time.Duration
+	if days, ok := strings.CutSuffix(w, "d"); ok {
+		n, perr := strconv.Atoi(days)
+		if perr != nil || n <= 0 {
+			return from, to, fmt.Errorf("history: bad window %q", w)
+		}
+		span = time.Duration(n) * 24 * time.Hour
+	} else if span, err = time.ParseDuration(w); err != nil || span <= 0 {
+		return from, to, fmt.Errorf("history: bad window %q: want today, yesterday, or a span like 1h or 7d", w)
+	}
+	return now.Add(-span), to, nil
+}
@@ -0,0 +1,221 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openAt opens the history in dir on UTC days, with a clock that reads
+// *now.
+func openAt(t *testing.T, dir string, retention int, now *time.Time) *Store {
+	t.Helper()
+	s := &Store{
+		dir:       dir,
+		retention: retention,
+		loc:       time.UTC,
+		buckets:   map[int64]*bucket{},
+		days:      map[string]bool{},
+		now:       func() time.Time { return *now },
+	}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func at(day string, clock string) time.Time {
+	t, err := time.Parse(dayLayout+" 15:04:05", day+" "+clock)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// writeDay writes a history file by hand, as an earlier run would have.
+func writeDay(t *testing.T, dir, day string, recs ...Record) {
+	t.Helper()
+	var b []byte
+	for _, r := range recs {
+		line, _ := json.Marshal(r)
+		b = append(append(b, line...), '\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, day+".jsonl"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dayFiles(t *testing.T, s *Store) []string {
+	t.Helper()
+	days, err := s.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return days
+}
+
+func TestMinuteBuckets(t *testing.T) {
+	dir := t.TempDir()
+	now := at("2026-03-10", "12:02:00")
+	s := openAt(t, dir, 7, &now)
+	for _, r := range []Record{
+		{at("2026-03-10", "12:00:05"), map[string]float64{"cpu": 10, "ram": 5}},
+		{at("2026-03-10", "12:00:50"), map[string]float64{"cpu": 30}},
+		{at("2026-03-10", "12:01:10"), map[string]float64{"cpu": 50}},
+	} {
+		if err := s.Append(r.Time, r.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	check := func(name string, s *Store) {
+		minute := at("2026-03-10", "12:00:00").Unix() / 60
+		if len(s.buckets) != 2 {
+			t.Fatalf("%s: %d buckets, want one per minute", name, len(s.buckets))
+		}
+		b := s.buckets[minute]
+		if b == nil || b.n["cpu"] != 2 || b.sum["cpu"] != 40 || b.max["cpu"] != 30 || b.n["ram"] != 1 {
+			t.Errorf("%s: 12:00 bucket = %+v, want two cpu samples summing to 40, max 30, and one ram", name, b)
+		}
+	}
+	check("appended", s)
+
+	// a torn last line, as a crash leaves it, is skipped on load
+	f, err := os.OpenFile(filepath.Join(dir, "2026-03-10.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"t":"2026-03-10T12:01:`)
+	f.Close()
+	check("reloaded", openAt(t, dir, 7, &now))
+}
+
+func TestAvgPeak(t *testing.T) {
+	dir := t.TempDir()
+	now := at("2026-03-10", "12:30:00")
+	s := openAt(t, dir, 7, &now)
+	for _, r := range []Record{
+		{at("2026-03-05", "09:00:00"), map[string]float64{"cpu": 100}},
+		{at("2026-03-09", "23:50:00"), map[string]float64{"cpu": 80}},
+		{at("2026-03-10", "00:10:00"), map[string]float64{"cpu": 20}},
+		{at("2026-03-10", "12:00:00"), map[string]float64{"cpu": 40}},
+		{at("2026-03-10", "12:29:30"), map[string]float64{"cpu": 60}},
+	} {
+		if err := s.Append(r.Time, r.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		metric, window string
+		avg, peak      float64
+	}{
+		{"cpu", "today", 40, 60},
+		{"cpu", "yesterday", 80, 80},
+		{"cpu", "1h", 50, 60},
+		{"cpu", "24h", 50, 80},
+		{"cpu", "7d", 60, 100},
+		{"ram", "today", 0, 0},
+	}
+	for _, tt := range tests {
+		avg, err := s.Avg(tt.metric, tt.window)
+		if err != nil || avg != tt.avg {
+			t.Errorf("Avg(%s, %s) = %v, %v, want %v", tt.metric, tt.window, avg, err, tt.avg)
+		}
+		peak, err := s.Peak(tt.metric, tt.window)
+		if err != nil || peak != tt.peak {
+			t.Errorf("Peak(%s, %s) = %v, %v, want %v", tt.metric, tt.window, peak, err, tt.peak)
+		}
+	}
+
+	for _, w := range []string{"", "week", "0d", "-2d", "-1h", "0s"} {
+		if _, err := s.Avg("cpu", w); err == nil {
+			t.Errorf("Avg(cpu, %q) accepted a bad window", w)
+		}
+	}
+}
+
+func TestStreakAcrossMidnight(t *testing.T) {
+	dir := t.TempDir()
+	writeDay(t, dir, "2026-03-06", Record{at("2026-03-06", "12:00:00"), map[string]float64{"cpu": 1}})
+	writeDay(t, dir, "2026-03-08", Record{at("2026-03-08", "23:00:00"), map[string]float64{"cpu": 1}})
+	now := at("2026-03-09", "23:59:50")
+	s := openAt(t, dir, 10, &now)
+
+	if got := s.Streak(); got != 0 {
+		t.Errorf("before today's first sample, Streak = %d, want 0", got)
+	}
+	if err := s.Append(now, map[string]float64{"cpu": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Streak(); got != 2 {
+		t.Errorf("Streak = %d, want 2", got)
+	}
+
+	now = at("2026-03-10", "00:00:10")
+	if got := s.Streak(); got != 0 {
+		t.Errorf("after midnight, with no sample yet, Streak = %d, want 0", got)
+	}
+	if err := s.Append(now, map[string]float64{"cpu": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Streak(); got != 3 {
+		t.Errorf("after midnight, Streak = %d, want 3", got)
+	}
+	want := []string{"2026-03-06", "2026-03-08", "2026-03-09", "2026-03-10"}
+	if got := dayFiles(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	s.Close()
+
+	if got := openAt(t, dir, 10, &now).Streak(); got != 3 {
+		t.Errorf("reloaded, Streak = %d, want 3", got)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	dir := t.TempDir()
+	for _, day := range []string{"2026-03-07", "2026-03-08", "2026-03-10"} {
+		writeDay(t, dir, day, Record{at(day, "08:00:00"), map[string]float64{"cpu": 10}})
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a day"), 0o600)
+
+	// three days including today: 03-08 to 03-10
+	now := at("2026-03-10", "09:00:00")
+	s := openAt(t, dir, 3, &now)
+	if got, want := dayFiles(t, s), []string{"2026-03-08", "2026-03-10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("on open, files = %v, want %v", got, want)
+	}
+	if peak, _ := s.Peak("cpu", "7d"); peak != 10 || s.Streak() != 1 {
+		t.Errorf("on open, Peak = %v and Streak = %d, want 10 and 1", peak, s.Streak())
+	}
+	if avg, _ := s.Avg("cpu", "7d"); avg != 10 {
+		t.Errorf("on open, Avg = %v, want only the retained samples", avg)
+	}
+
+	// the first sample of a new day rotates and expires 03-08
+	now = at("2026-03-11", "00:01:00")
+	if err := s.Append(now, map[string]float64{"cpu": 30}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dayFiles(t, s), []string{"2026-03-10", "2026-03-11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after rotating, files = %v, want %v", got, want)
+	}
+	if avg, _ := s.Avg("cpu", "7d"); avg != 20 {
+		t.Errorf("after rotating, Avg = %v, want 20 without the expired day", avg)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("a file that is not a day was touched: %v", err)
+	}
+}
+
+func TestOpenRetention(t *testing.T) {
+	if _, err := Open(t.TempDir(), 0); err == nil {
+		t.Error("Open accepted a retention of zero days")
+	}
+}
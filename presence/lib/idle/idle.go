@@ -0,0 +1,176 @@
+// Package idle tells how long the user has been away from the machine,
+// from logind's idle hint or from the interrupt counters of input devices.
+package idle
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source reports how long there has been no user input.
+type Source interface {
+	Idle(ctx context.Context) (time.Duration, error)
+}
+
+// Logind reads the IdleHint of a login session, which desktop
+// environments set after their own idle timeout.
+type Logind struct {
+	// Session is the session ID; empty means $XDG_SESSION_ID, or the
+	// user's display session when that is unset too, as under a user
+	// service.
+	Session string
+}
+
+// Idle implements Source with loginctl, so no D-Bus library is needed.
+func (l Logind) Idle(ctx context.Context) (time.Duration, error) {
+	session := l.Session
+	if session == "" {
+		session = os.Getenv("XDG_SESSION_ID")
+	}
+	if session == "" {
+		session = "auto"
+	}
+	out, err := exec.CommandContext(ctx, "loginctl", "show-session", session,
+		"-p", "IdleHint", "-p", "IdleSinceHint").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return 0, fmt.Errorf("loginctl: %w", err)
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	if props["IdleHint"] != "yes" {
+		return 0, nil
+	}
+	usec, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("loginctl: bad IdleSinceHint %q", props["IdleSinceHint"])
+	}
+	return max(time.Since(time.UnixMicro(usec)), 0), nil
+}
+
+// DefaultInputIRQs match the /proc/interrupts lines of keyboards, mice
+// and touchpads, built in or on USB. USB controllers serve other devices
+// too, so a busy USB disk reads as input.
+var DefaultInputIRQs = []string{"i8042", "hid", "keyboard", "mouse", "touchpad", "xhci", "ehci"}
+
+// Interrupts watches the counters of the /proc/interrupts lines whose
+// description contains one of Match: while they do not move, nobody is
+// typing or moving the mouse. It works without a desktop session but
+// only counts from the first call, which is taken as activity.
+type Interrupts struct {
+	// Match defaults to DefaultInputIRQs; Path to /proc/interrupts.
+	Match []string
+	Path  string
+
+	mu    sync.Mutex
+	last  uint64
+	since time.Time
+}
+
+// Idle implements Source.
+func (s *Interrupts) Idle(context.Context) (time.Duration, error) {
+	path := s.Path
+	if path == "" {
+		path = "/proc/interrupts"
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	match := s.Match
+	if match == nil {
+		match = DefaultInputIRQs
+	}
+	total, found := countInterrupts(b, match)
+	if !found {
+		return 0, fmt.Errorf("no input interrupts in %s match %v", path, match)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.since.IsZero() || total != s.last {
+		s.last, s.since = total, now
+	}
+	return now.Sub(s.since), nil
+}
+
+// countInterrupts sums the per-CPU counts of the lines matching any of
+// match, case-insensitively.
+func countInterrupts(b []byte, match []string) (total uint64, found bool) {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Scan() // the CPU0 CPU1 ... header
+	for sc.Scan() {
+		line := sc.Text()
+		lower := strings.ToLower(line)
+		matched := false
+		for _, m := range match {
+			if strings.Contains(lower, strings.ToLower(m)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		_, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		found = true
+		for _, f := range strings.Fields(rest) {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				// the counts end where the chip and device names start
+				break
+			}
+			total += n
+		}
+	}
+	return total, found
+}
+
+// Longest asks every source and returns the longest idle time among
+// those that answer. Each misses something: logind's hint never comes on
+// under desktops that do not set it, and the counters of a USB controller
+// move for other devices too, so either one seeing the user gone is
+// enough. It fails only if all of them do.
+func Longest(sources ...Source) Source {
+	return longest(sources)
+}
+
+type longest []Source
+
+func (l longest) Idle(ctx context.Context) (time.Duration, error) {
+	var errs []error
+	best, ok := time.Duration(0), false
+	for _, s := range l {
+		d, err := s.Idle(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok || d > best {
+			best, ok = d, true
+		}
+	}
+	if !ok {
+		return 0, errors.Join(errs...)
+	}
+	return best, nil
+}
@@ -0,0 +1,103 @@
+package idle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const interrupts = `           CPU0       CPU1       CPU2       CPU3
+  0:         36          0          0          0   IO-APIC    2-edge      timer
+  1:       1200         34          0          0   IO-APIC    1-edge      i8042
+  8:          0          0          0          1   IO-APIC    8-edge      rtc0
+ 12:        500          0        100          0   IO-APIC   12-edge      i8042
+ 16:          0          0          0          0   IO-APIC   16-fasteoi   ehci_hcd:usb1
+124:       9000          0          0          0   PCI-MSI 327680-edge      xhci_hcd
+125:          0      77000          0          0   PCI-MSI 1048576-edge      nvme0q1
+NMI:          2          3          4          5   Non-maskable interrupts
+LOC:     123456     123456     123456     123456   Local timer interrupts
+ERR:          0
+`
+
+func TestCountInterrupts(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		match     []string
+		want      uint64
+		wantFound bool
+	}{
+		{"defaults", interrupts, DefaultInputIRQs, 1234 + 600 + 9000, true},
+		{"xhci only", interrupts, []string{"xhci"}, 9000, true},
+		{"ehci, never fired", interrupts, []string{"ehci"}, 0, true},
+		{"case-insensitive", interrupts, []string{"I8042"}, 1234 + 600, true},
+		{"no such device", interrupts, []string{"touchpad"}, 0, false},
+		{"header is not a device", interrupts, []string{"CPU0"}, 0, false},
+		{"empty file", "", DefaultInputIRQs, 0, false},
+	}
+	for _, tt := range tests {
+		total, found := countInterrupts([]byte(tt.in), tt.match)
+		if total != tt.want || found != tt.wantFound {
+			t.Errorf("%s: countInterrupts = %d, %v, want %d, %v", tt.name, total, found, tt.want, tt.wantFound)
+		}
+	}
+}
+
+func TestInterruptsIdle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "interrupts")
+	os.WriteFile(path, []byte(interrupts), 0o600)
+	s := &Interrupts{Path: path}
+	ctx := context.Background()
+
+	if _, err := s.Idle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := s.since
+	time.Sleep(10 * time.Millisecond)
+	if d, err := s.Idle(ctx); err != nil || d < 10*time.Millisecond {
+		t.Errorf("unchanged counters: Idle = %v, %v, want at least 10ms", d, err)
+	}
+
+	os.WriteFile(path, []byte(interrupts+" 13:          1          0          0          0   IO-APIC   13-edge      hid-mouse\n"), 0o600)
+	if d, err := s.Idle(ctx); err != nil || d != 0 || !s.since.After(first) {
+		t.Errorf("after input: Idle = %v, %v, want 0", d, err)
+	}
+
+	if _, err := (&Interrupts{Path: path, Match: []string{"touchpad"}}).Idle(ctx); err == nil {
+		t.Error("Idle succeeded without a matching line")
+	}
+}
+
+type fixed struct {
+	d   time.Duration
+	err error
+}
+
+func (f fixed) Idle(context.Context) (time.Duration, error) { return f.d, f.err }
+
+func TestLongest(t *testing.T) {
+	broken := errors.New("loginctl: no session")
+	tests := []struct {
+		name    string
+		sources []Source
+		want    time.Duration
+		wantErr bool
+	}{
+		{"longest wins", []Source{fixed{d: time.Minute}, fixed{d: time.Hour}}, time.Hour, false},
+		{"failing source ignored", []Source{fixed{err: broken}, fixed{d: time.Minute}}, time.Minute, false},
+		{"failure does not count as idle", []Source{fixed{d: 0}, fixed{d: time.Hour, err: broken}}, 0, false},
+		{"all fail", []Source{fixed{err: broken}, fixed{err: broken}}, 0, true},
+	}
+	for _, tt := range tests {
+		d, err := Longest(tt.sources...).Idle(context.Background())
+		if d != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Idle = %v, %v, want %v, error %v", tt.name, d, err, tt.want, tt.wantErr)
+		}
+		if tt.wantErr && !errors.Is(err, broken) {
+			t.Errorf("%s: error %v does not carry the sources' errors", tt.name, err)
+		}
+	}
+}
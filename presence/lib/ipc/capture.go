@@ -0,0 +1,90 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Directions of a captured frame, as seen from this process.
+const (
+	DirSend = "send"
+	DirRecv = "recv"
+)
+
+// Record is one captured frame, a line of a capture file. Payloads that
+// are not JSON are kept as Text instead.
+type Record struct {
+	Time    time.Time       `json:"ts"`
+	Dir     string          `json:"dir"`
+	Opcode  int             `json:"op"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Text    string          `json:"text,omitempty"`
+}
+
+// Bytes returns the payload as it went over the wire.
+func (r Record) Bytes() []byte {
+	if r.Payload != nil {
+		return r.Payload
+	}
+	return []byte(r.Text)
+}
+
+// Recorder writes frames to a JSONL capture. It is safe for concurrent use.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record appends one frame. Write errors are dropped: a capture is a
+// debugging aid and must never break the connection it watches.
+func (r *Recorder) Record(dir string, opcode int, payload []byte) {
+	if r == nil {
+		return
+	}
+	rec := Record{Time: time.Now(), Dir: dir, Opcode: opcode}
+	if json.Valid(payload) {
+		rec.Payload = append(json.RawMessage(nil), payload...)
+	} else {
+		rec.Text = string(payload)
+	}
+	r.mu.Lock()
+	r.enc.Encode(rec)
+	r.mu.Unlock()
+}
+
+var recorder *Recorder
+
+// SetRecorder captures every frame sent and read over the socket from
+// now on; nil stops capturing.
+func SetRecorder(r *Recorder) {
+	recorder = r
+}
+
+// ReadCapture parses a capture written by a Recorder.
+func ReadCapture(r io.Reader) ([]Record, error) {
+	var recs []Record
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Dir != DirSend && rec.Dir != DirRecv {
+			return nil, fmt.Errorf("line %d: unknown direction %q", line, rec.Dir)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
@@ -0,0 +1,26 @@
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+var (
+	// ErrNotConnected is returned when there is no open socket to use.
+	ErrNotConnected = errors.New("ipc: not connected")
+	// ErrClosed is returned when the other side closed the connection,
+	// with a CLOSE frame or by hanging up.
+	ErrClosed = errors.New("ipc: connection closed")
+)
+
+// closedError wraps err in ErrClosed if it means the connection is gone.
+func closedError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package ipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Opcodes of the Discord IPC protocol.
+const (
+	OpHandshake = 0
+	OpFrame     = 1
+	OpClose     = 2
+	OpPing      = 3
+	OpPong      = 4
+)
+
+// DefaultMaxFrameSize bounds payloads when no other limit is set. Real
+// frames are a few KiB at most.
+const DefaultMaxFrameSize = 1 << 20
+
+var (
+	// ErrFrameTooLarge is returned for a header claiming more than the
+	// decoder's limit; the payload is not read.
+	ErrFrameTooLarge = errors.New("ipc: frame too large")
+	// ErrBadOpcode is returned for a header with an unknown opcode,
+	// which means the stream is not Discord IPC or is out of step.
+	ErrBadOpcode = errors.New("ipc: unknown opcode")
+	// ErrBadPayload is returned for a well-framed, non-empty payload
+	// that is not JSON. The frame has been consumed, so the stream is
+	// still in step.
+	ErrBadPayload = errors.New("ipc: payload is not JSON")
+)
+
+// Decoder reads frames from a stream, validating each header before
+// allocating for its payload. After any error other than ErrBadPayload
+// the stream cannot be trusted and should be closed.
+type Decoder struct {
+	r   io.Reader
+	max int
+	hdr [8]byte
+}
+
+// NewDecoder returns a decoder reading from r that rejects payloads over
+// max bytes; max <= 0 means DefaultMaxFrameSize.
+func NewDecoder(r io.Reader, max int) *Decoder {
+	if max <= 0 {
+		max = DefaultMaxFrameSize
+	}
+	return &Decoder{r: r, max: max}
+}
+
+// Decode reads one frame: an 8-byte little-endian header holding the
+// opcode and payload length, then the JSON payload.
+func (d *Decoder) Decode() (opcode int, payload []byte, err error) {
+	if _, err := io.ReadFull(d.r, d.hdr[:]); err != nil {
+		return 0, nil, fmt.Errorf("read header error: %w", err)
+	}
+	op := binary.LittleEndian.Uint32(d.hdr[0:4])
+	length := binary.LittleEndian.Uint32(d.hdr[4:8])
+	if op > OpPong {
+		return 0, nil, fmt.Errorf("%w %d", ErrBadOpcode, op)
+	}
+	if uint64(length) > uint64(d.max) {
+		return 0, nil, fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, length, d.max)
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("read payload error: %w", err)
+	}
+	// an empty payload is no JSON either, but peers send it and always
+	// have been let through
+	if length > 0 && !json.Valid(payload) {
+		return int(op), payload, fmt.Errorf("%w: opcode %d, %d bytes", ErrBadPayload, op, length)
+	}
+	return int(op), payload, nil
+}
+
+// ReadFrame reads one frame from r with the default limits. Callers
+// reading many frames from one stream should keep a Decoder instead.
+func ReadFrame(r io.Reader) (opcode int, payload []byte, err error) {
+	return NewDecoder(r, 0).Decode()
+}
+
+// WriteFrame writes payload as one frame with a single Write, so frames
+// from concurrent writers never interleave on a socket.
+func WriteFrame(w io.Writer, opcode int, payload []byte) error {
+	msg := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(opcode))
+	binary.LittleEndian.PutUint32(msg[4:8], uint32(len(payload)))
+	copy(msg[8:], payload)
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package ipc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// frame builds a raw frame whose header claims length, whatever the
+// payload really holds.
+func frame(op, length uint32, payload string) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], op)
+	binary.LittleEndian.PutUint32(b[4:8], length)
+	return append(b, payload...)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		max     int
+		wantOp  int
+		want    string
+		wantErr error
+	}{
+		{name: "frame", in: frame(OpFrame, 7, `{"a":1}`), wantOp: OpFrame, want: `{"a":1}`},
+		{name: "pong", in: frame(OpPong, 2, `{}`), wantOp: OpPong, want: `{}`},
+		{name: "at the limit", in: frame(OpFrame, 7, `{"a":1}`), max: 7, wantOp: OpFrame, want: `{"a":1}`},
+		{name: "over the limit", in: frame(OpFrame, 7, `{"a":1}`), max: 6, wantErr: ErrFrameTooLarge},
+		{name: "huge length", in: frame(OpFrame, 0xffffffff, ""), wantErr: ErrFrameTooLarge},
+		{name: "bad opcode", in: frame(OpPong+1, 2, `{}`), wantErr: ErrBadOpcode},
+		{name: "http on the socket", in: []byte("GET / HTTP/1.1\r\n\r\n"), wantErr: ErrBadOpcode},
+		{name: "invalid json", in: frame(OpFrame, 5, `{"a":`), wantErr: ErrBadPayload},
+		{name: "empty payload", in: frame(OpPing, 0, ""), wantOp: OpPing, want: ""},
+		{name: "empty payload, more follows", in: frame(OpFrame, 0, `{}`), wantOp: OpFrame, want: ""},
+		{name: "no header", in: nil, wantErr: io.EOF},
+		{name: "short header", in: []byte{1, 0, 0}, wantErr: io.ErrUnexpectedEOF},
+		{name: "short payload", in: frame(OpFrame, 10, `{}`), wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, payload, err := NewDecoder(bytes.NewReader(tt.in), tt.max).Decode()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op != tt.wantOp || string(payload) != tt.want {
+				t.Errorf("Decode = %d %q, want %d %q", op, payload, tt.wantOp, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStaysInStep(t *testing.T) {
+	// a frame that is not JSON is consumed whole, so the next one reads
+	in := append(frame(OpFrame, 3, "abc"), frame(OpFrame, 2, `{}`)...)
+	dec := NewDecoder(bytes.NewReader(in), 0)
+	if _, _, err := dec.Decode(); !errors.Is(err, ErrBadPayload) {
+		t.Fatalf("first Decode error = %v, want %v", err, ErrBadPayload)
+	}
+	if op, payload, err := dec.Decode(); err != nil || op != OpFrame || string(payload) != `{}` {
+		t.Errorf("second Decode = %d %q %v, want %d {}", op, payload, err, OpFrame)
+	}
+}
+
+func TestWriteFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, OpHandshake, []byte(`{"v":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), frame(OpHandshake, 7, `{"v":1}`)) {
+		t.Fatalf("WriteFrame wrote % x", buf.Bytes())
+	}
+	if op, payload, err := ReadFrame(&buf); err != nil || op != OpHandshake || string(payload) != `{"v":1}` {
+		t.Errorf("ReadFrame = %d %q %v", op, payload, err)
+	}
+}
+
+// TestReadClosesOutOfStep checks that read hangs up on a header it cannot
+// trust, but keeps the socket after a bad payload.
+func TestReadClosesOutOfStep(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        []byte
+		wantErr   error
+		wantClose bool
+	}{
+		{"too large", frame(OpFrame, DefaultMaxFrameSize+1, ""), ErrFrameTooLarge, true},
+		{"bad opcode", frame(9, 2, `{}`), ErrBadOpcode, true},
+		{"invalid json", frame(OpFrame, 3, "abc"), ErrBadPayload, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer remote.Close()
+			socket = local
+			defer CloseSocket()
+			go remote.Write(tt.in)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := Read(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Read error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantClose != errors.Is(err, ErrClosed) {
+				t.Errorf("Read error = %v, wrapping ErrClosed: %v, want %v", err, errors.Is(err, ErrClosed), tt.wantClose)
+			}
+			if closed := socket == nil; closed != tt.wantClose {
+				t.Errorf("socket closed: %v, want %v", closed, tt.wantClose)
+			}
+		})
+	}
+}
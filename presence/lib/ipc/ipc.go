@@ -1,10 +1,12 @@
 package ipc
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"time"
 )
 
 var (
@@ -12,6 +14,20 @@ var (
 	ipcPath string
 )
 
+// dialTimeout bounds Dial when the caller's context has no deadline.
+const dialTimeout = 2 * time.Second
+
+var maxFrameSize = DefaultMaxFrameSize
+
+// SetMaxFrameSize bounds the frames read from the socket; n <= 0
+// restores DefaultMaxFrameSize.
+func SetMaxFrameSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxFrameSize
+	}
+	maxFrameSize = n
+}
+
 // GetIpcPath returns the directory for the IPC socket
 // cache the result so that filesystem checks and environment lookups are done once
 func GetIpcPath() string {
@@ -44,62 +60,113 @@ func GetIpcPath() string {
 	return ipcPath
 }
 
+// CloseSocket closes the socket, if open. Closing twice is not an error.
 func CloseSocket() error {
-	if socket != nil {
-		socket.Close()
-		socket = nil
+	if socket == nil {
+		return nil
 	}
-	return nil
+	err := socket.Close()
+	socket = nil
+	return err
 }
 
-// Read returns the IPC socket response as a string
-// simply slice the backing array.
-func Read() (string, error) {
-    // read exactly 8-byte header
-    hdr := make([]byte, 8)
-    n := 0
-    for n < 8 {
-        nn, err := socket.Read(hdr[n:])
-        if err != nil {
-            return "", fmt.Errorf("read header error: %w", err)
-        }
-        n += nn
-    }
-    // opcode := binary.LittleEndian.Uint32(hdr[0:4])
-    length := binary.LittleEndian.Uint32(hdr[4:8])
+// Close sends a CLOSE frame, telling Discord the connection is going away
+// on purpose, and closes the socket. The socket is closed even if the
+// frame could not be sent.
+func Close(ctx context.Context) error {
+	if socket == nil {
+		return nil
+	}
+	payload := []byte(`{}`)
+	err := withContext(ctx, func() error {
+		if err := WriteFrame(socket, OpClose, payload); err != nil {
+			return closedError(err)
+		}
+		logger.Debug("frame sent", "op", OpClose, "len", len(payload))
+		recorder.Record(DirSend, OpClose, payload)
+		return nil
+	})
+	if cerr := CloseSocket(); err == nil {
+		err = cerr
+	}
+	return err
+}
 
-    if length == 0 {
-        return "", nil
-    }
+// Read returns the IPC socket response as a string. A CLOSE frame is
+// returned along with ErrClosed.
+func Read(ctx context.Context) (string, error) {
+    var resp string
+    err := withContext(ctx, func() error {
+        var err error
+        resp, err = read()
+        return err
+    })
+    return resp, err
+}
 
-    buf := make([]byte, length)
-    got := 0
-    for uint32(got) < length {
-        nn, err := socket.Read(buf[got:])
-        if err != nil {
-            return "", fmt.Errorf("read payload error: %w", err)
+// Send writes one frame and returns the response to it.
+func Send(ctx context.Context, opcode int, payload string) (string, error) {
+    var resp string
+    err := withContext(ctx, func() error {
+        if err := WriteFrame(socket, opcode, []byte(payload)); err != nil {
+            return closedError(err)
         }
-        got += nn
-    }
-
-    // optional: debug log
-    // fmt.Printf("Read opcode=%d length=%d\n", opcode, length)
-    return string(buf), nil
+        logger.Debug("frame sent", "op", opcode, "len", len(payload))
+        recorder.Record(DirSend, opcode, []byte(payload))
+
+        var err error
+        resp, err = read()
+        return err
+    })
+    return resp, err
 }
 
-func Send(opcode int, payload string) (string, error) {
-    hdr := make([]byte, 8)
-    binary.LittleEndian.PutUint32(hdr[0:4], uint32(opcode))
-    binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(payload)))
-
-    msg := append(hdr, []byte(payload)...)
-    if _, err := socket.Write(msg); err != nil {
-        return "", fmt.Errorf("write error: %w", err)
+func read() (string, error) {
+    opcode, payload, err := NewDecoder(socket, maxFrameSize).Decode()
+    if errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrBadOpcode) {
+        // the stream is out of step for good; hang up rather than guess
+        CloseSocket()
+        return "", fmt.Errorf("%w: %w", ErrClosed, err)
     }
-
-    resp, err := Read()
     if err != nil {
-        return "", err
+        return "", closedError(err)
+    }
+    logger.Debug("frame received", "op", opcode, "len", len(payload))
+    recorder.Record(DirRecv, opcode, payload)
+    if opcode == OpClose {
+        return string(payload), fmt.Errorf("%w by peer: %s", ErrClosed, payload)
+    }
+    return string(payload), nil
+}
+
+// withContext runs fn against the socket under ctx: the deadline of ctx
+// becomes the socket's, and cancelling ctx interrupts I/O in flight. An
+// interrupted frame leaves the stream out of step, so the socket is
+// closed and later calls get ErrNotConnected.
+func withContext(ctx context.Context, fn func() error) error {
+    if socket == nil {
+        return ErrNotConnected
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    conn := socket
+    deadline, _ := ctx.Deadline()
+    conn.SetDeadline(deadline)
+    stop := context.AfterFunc(ctx, func() {
+        conn.SetDeadline(time.Now())
+    })
+    err := fn()
+    stop()
+    conn.SetDeadline(time.Time{})
+
+    if err != nil && (ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded)) {
+        CloseSocket()
+        cause := ctx.Err()
+        if cause == nil {
+            cause = context.DeadlineExceeded
+        }
+        return fmt.Errorf("%w: %v", cause, err)
     }
-    return resp, nil
+    return err
 }
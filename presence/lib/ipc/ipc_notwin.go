@@ -4,17 +4,59 @@
 package ipc
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"os"
 	"time"
 )
 
-// openSocket opens the discord-ipc-0 unix socket
-func OpenSocket() error {
-	sock, err := net.DialTimeout("unix", GetIpcPath()+"/discord-ipc-0", time.Second*2)
-	if err != nil {
-		return err
+// SocketPath returns the path of the discord-ipc-n unix socket
+func SocketPath(n int) string {
+	return fmt.Sprintf("%s/discord-ipc-%d", GetIpcPath(), n)
+}
+
+// Dial connects to the discord-ipc-n unix socket, giving up after two
+// seconds unless ctx has a deadline of its own
+func Dial(ctx context.Context, n int) (net.Conn, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
 	}
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", SocketPath(n))
+}
 
-	socket = sock
-	return nil
+// Listen serves a discord-ipc-n socket of our own, replacing one left
+// behind by a dead process
+func Listen(n int) (net.Listener, error) {
+	path := SocketPath(n)
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use", path)
+	}
+	os.Remove(path)
+	return net.Listen("unix", path)
+}
+
+// OpenSocket opens the first discord-ipc-n unix socket that answers, trying
+// 0 to 9 as Discord takes the next free one when 0 is held. The error is
+// the one for discord-ipc-0
+func OpenSocket(ctx context.Context) error {
+	var first error
+	for n := 0; n < 10; n++ {
+		sock, err := Dial(ctx, n)
+		if err == nil {
+			socket = sock
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return first
 }
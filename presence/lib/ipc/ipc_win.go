@@ -4,21 +4,57 @@
 package ipc
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"time"
 
 	npipe "gopkg.in/natefinch/npipe.v2"
 )
 
-// openSocket opens the discord-ipc-0 named pipe
-func OpenSocket() error {
+// SocketPath returns the path of the discord-ipc-n named pipe
+func SocketPath(n int) string {
+	return fmt.Sprintf(`\\.\pipe\discord-ipc-%d`, n)
+}
+
+// Dial connects to the discord-ipc-n named pipe, giving up after two
+// seconds or at the deadline of ctx, whichever comes first
+func Dial(ctx context.Context, n int) (net.Conn, error) {
 	// connect to the Windows named pipe, this is a well known name
 	// we use DialTimeout since it will block forever (or very very long) on Windows
 	// if the pipe is not available (Discord not running)
-	sock, err := npipe.DialTimeout(`\\.\pipe\discord-ipc-0`, time.Second*2)
-	if err != nil {
-		return err
+	timeout := dialTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return npipe.DialTimeout(SocketPath(n), timeout)
+}
 
-	socket = sock
-	return nil
+// Listen serves a discord-ipc-n named pipe of our own
+func Listen(n int) (net.Listener, error) {
+	return npipe.Listen(SocketPath(n))
+}
+
+// OpenSocket opens the first discord-ipc-n named pipe that answers, trying
+// 0 to 9 as Discord takes the next free one when 0 is held. The error is
+// the one for discord-ipc-0
+func OpenSocket(ctx context.Context) error {
+	var first error
+	for n := 0; n < 10; n++ {
+		sock, err := Dial(ctx, n)
+		if err == nil {
+			socket = sock
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return first
 }
@@ -0,0 +1,325 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format, without the client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics in the order they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// desc is what every metric family has.
+type desc struct {
+	name, help, typ string
+	labels          []string
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// key joins label values into a map key; "\xff" never occurs in UTF-8.
+func key(values []string) string { return strings.Join(values, "\xff") }
+
+// labelPairs formats the labels of one series, with extra appended.
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l + `="` + escapeValue(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i] + `="` + escapeValue(extra[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (d *desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// series holds one value per label combination.
+type series struct {
+	desc
+	mu   sync.Mutex
+	vals map[string]float64
+	keys map[string][]string
+}
+
+func newSeries(name, help, typ string, labels []string) series {
+	return series{
+		desc: desc{name: name, help: help, typ: typ, labels: labels},
+		vals: map[string]float64{},
+		keys: map[string][]string{},
+	}
+}
+
+func (s *series) update(values []string, f func(float64) float64) {
+	s.check(values)
+	k := key(values)
+	s.mu.Lock()
+	if _, ok := s.keys[k]; !ok {
+		s.keys[k] = append([]string(nil), values...)
+	}
+	s.vals[k] = f(s.vals[k])
+	s.mu.Unlock()
+}
+
+func (s *series) write(w *bufio.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.vals) == 0 && len(s.labels) > 0 {
+		return
+	}
+	s.header(w)
+	if len(s.labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", s.name, formatValue(s.vals[""]))
+		return
+	}
+	for _, k := range sortedKeys(s.vals) {
+		fmt.Fprintf(w, "%s%s %s\n", s.name, s.labelPairs(s.keys[k]), formatValue(s.vals[k]))
+	}
+}
+
+// Counter only goes up.
+type Counter struct{ series }
+
+// Counter registers a counter. The name should end in _total.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{newSeries(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series of the given label values.
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+// Gauge goes up and down.
+type Gauge struct{ series }
+
+// Gauge registers a gauge.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newSeries(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the series of the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return v })
+}
+
+// Sample is one series of a GaugeFunc.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type gaugeFunc struct {
+	desc
+	f func() []Sample
+}
+
+// GaugeFunc registers a gauge whose series are read from f on every
+// scrape, for values the program keeps anyway.
+func (r *Registry) GaugeFunc(name, help string, f func() []Sample, labels ...string) {
+	r.register(&gaugeFunc{desc{name: name, help: help, typ: "gauge", labels: labels}, f})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	samples := g.f()
+	if len(samples) == 0 {
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return key(samples[i].LabelValues) < key(samples[j].LabelValues)
+	})
+	g.header(w)
+	for _, s := range samples {
+		g.check(s.LabelValues)
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(s.LabelValues), formatValue(s.Value))
+	}
+}
+
+// DefBuckets suit latencies in seconds from a millisecond to ten seconds.
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu   sync.Mutex
+	data map[string]*histData
+}
+
+type histData struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram registers a histogram with the given upper bounds, in
+// increasing order; nil means DefBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &Histogram{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		data:    map[string]*histData{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the series of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.check(labelValues)
+	k := key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.data[k]
+	if !ok {
+		d = &histData{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.data[k] = d
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		d.counts[i]++
+	}
+	d.count++
+	d.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.data) == 0 && len(h.labels) > 0 {
+		return
+	}
+	h.header(w)
+	if len(h.labels) == 0 && len(h.data) == 0 {
+		h.data[""] = &histData{counts: make([]uint64, len(h.buckets))}
+	}
+	keys := make([]string, 0, len(h.data))
+	for k := range h.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d := h.data[k]
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += d.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(d.labels, "le", formatValue(b)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(d.labels, "le", "+Inf"), d.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(d.labels), formatValue(d.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(d.labels), d.count)
+	}
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP serves the metrics, so a Registry can be mounted at /metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"example.com/presence/lib/client"
+)
+
+// Metric names of the built-in providers, also used to key thresholds and
+// templates. Per-interface network metrics are named "net_rx.<iface>" and
+// "net_tx.<iface>".
+const (
+	MetricCPU   = "cpu"
+	MetricRAM   = "ram"
+	MetricNetRx = "net_rx"
+	MetricNetTx = "net_tx"
+)
+
+// Threshold is the smallest change of a metric worth showing.
+// Abs is an absolute delta in the metric's own unit, Rel a fraction of the
+// value currently shown. A change passes if it reaches either one; with
+// both left at zero every change passes.
+type Threshold struct {
+	Abs float64 `json:"abs,omitempty"`
+	Rel float64 `json:"rel,omitempty"`
+}
+
+func (t Threshold) exceeded(shown, cur float64) bool {
+	d := math.Abs(cur - shown)
+	if t.Abs <= 0 && t.Rel <= 0 {
+		return d > 0
+	}
+	if t.Abs > 0 && d >= t.Abs {
+		return true
+	}
+	return t.Rel > 0 && d >= t.Rel*math.Abs(shown)
+}
+
+// ewma damps spikes with an exponentially weighted moving average per metric.
+type ewma struct {
+	alpha float64
+	avg   map[string]float64
+}
+
+func newEWMA(alpha float64) *ewma {
+	return &ewma{alpha: alpha, avg: map[string]float64{}}
+}
+
+// apply smooths every value in m in place. Alpha 0 (or 1) leaves m untouched.
+func (e *ewma) apply(m map[string]float64) {
+	if e.alpha <= 0 || e.alpha >= 1 {
+		return
+	}
+	for k, v := range m {
+		prev, ok := e.avg[k]
+		if ok {
+			v = e.alpha*v + (1-e.alpha)*prev
+		}
+		e.avg[k] = v
+		m[k] = v
+	}
+}
+
+// changeGate remembers the metric values behind the last Activity that was
+// actually sent and only lets through the ones that moved past their threshold.
+type changeGate struct {
+	thresholds map[string]Threshold
+	shown      map[string]float64
+}
+
+func newChangeGate(thresholds map[string]Threshold) *changeGate {
+	return &changeGate{thresholds: thresholds, shown: map[string]float64{}}
+}
+
+// hold returns the values to render: the new value where it changed
+// meaningfully, the previously shown value everywhere else.
+func (g *changeGate) hold(cur map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(cur))
+	for k, v := range cur {
+		shown, ok := g.shown[k]
+		if ok && !g.threshold(k).exceeded(shown, v) {
+			v = shown
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// threshold returns the threshold for metric name. Per-interface metrics
+// such as "net_rx.eth0" fall back to their base metric's threshold.
+func (g *changeGate) threshold(name string) Threshold {
+	if t, ok := g.thresholds[name]; ok {
+		return t
+	}
+	base, _, _ := strings.Cut(name, ".")
+	return g.thresholds[base]
+}
+
+// commit records vals as shown, after the Activity rendered from them was sent.
+func (g *changeGate) commit(vals map[string]float64) {
+	for k, v := range vals {
+		g.shown[k] = v
+	}
+}
+
+// ActivityEqual reports whether a and b would look the same on Discord.
+func ActivityEqual(a, b *client.Activity) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Details != b.Details || a.State != b.State ||
+		a.LargeImage != b.LargeImage || a.LargeText != b.LargeText ||
+		a.SmallImage != b.SmallImage || a.SmallText != b.SmallText {
+		return false
+	}
+	if !timestampsEqual(a.Timestamps, b.Timestamps) {
+		return false
+	}
+	if (a.Party == nil) != (b.Party == nil) || a.Party != nil && *a.Party != *b.Party {
+		return false
+	}
+	if (a.Secrets == nil) != (b.Secrets == nil) || a.Secrets != nil && *a.Secrets != *b.Secrets {
+		return false
+	}
+	if len(a.Buttons) != len(b.Buttons) {
+		return false
+	}
+	for i := range a.Buttons {
+		if *a.Buttons[i] != *b.Buttons[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func timestampsEqual(a, b *client.Timestamps) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return timeEqual(a.Start, b.Start) && timeEqual(a.End, b.End)
+}
+
+// timeEqual compares at millisecond precision, which is all Discord receives.
+func timeEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.UnixMilli() == b.UnixMilli()
+}
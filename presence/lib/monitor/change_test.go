@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"example.com/presence/lib/client"
+)
+
+func TestThresholdExceeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		th        Threshold
+		shown, to float64
+		want      bool
+	}{
+		{"no threshold, same", Threshold{}, 5, 5, false},
+		{"no threshold, any change", Threshold{}, 5, 5.01, true},
+		{"abs below", Threshold{Abs: 5}, 40, 44.9, false},
+		{"abs reached", Threshold{Abs: 5}, 40, 45, true},
+		{"abs downwards", Threshold{Abs: 5}, 40, 35, true},
+		{"rel below", Threshold{Rel: 0.25}, 1000, 1249, false},
+		{"rel reached", Threshold{Rel: 0.25}, 1000, 1250, true},
+		{"rel of a negative value", Threshold{Rel: 0.5}, -10, -15, true},
+		{"rel from zero", Threshold{Rel: 0.25}, 0, 0.001, true},
+		{"either, abs only", Threshold{Abs: 100, Rel: 0.5}, 1000, 1100, true},
+		{"either, rel only", Threshold{Abs: 100, Rel: 0.5}, 10, 15, true},
+		{"either, neither", Threshold{Abs: 100, Rel: 0.5}, 1000, 1099, false},
+		{"negative abs is off", Threshold{Abs: -1, Rel: 0.5}, 10, 14, false},
+	}
+	for _, tt := range tests {
+		if got := tt.th.exceeded(tt.shown, tt.to); got != tt.want {
+			t.Errorf("%s: %+v.exceeded(%v, %v) = %v, want %v", tt.name, tt.th, tt.shown, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestChangeGate(t *testing.T) {
+	g := newChangeGate(map[string]Threshold{
+		MetricCPU:             {Abs: 5},
+		MetricNetRx:           {Rel: 0.25},
+		MetricNetRx + ".eth0": {Abs: 1},
+	})
+	shown := map[string]float64{
+		MetricCPU:              40,
+		MetricNetRx + ".wlan0": 1000,
+		MetricNetRx + ".eth0":  1000,
+		MetricRAM:              50,
+	}
+	g.commit(shown)
+
+	tests := []struct {
+		name   string
+		metric string
+		cur    float64
+		want   float64
+	}{
+		{"held under abs", MetricCPU, 44, 40},
+		{"passed at abs", MetricCPU, 45, 45},
+		{"interface falls back to base", MetricNetRx + ".wlan0", 1200, 1000},
+		{"base threshold passes", MetricNetRx + ".wlan0", 1300, 1300},
+		{"own threshold wins", MetricNetRx + ".eth0", 1001, 1001},
+		{"no threshold passes any change", MetricRAM, 50.5, 50.5},
+		{"not shown yet passes", MetricNetRx + ".usb0", 7, 7},
+	}
+	for _, tt := range tests {
+		got := g.hold(map[string]float64{tt.metric: tt.cur})
+		if got[tt.metric] != tt.want {
+			t.Errorf("%s: hold(%s=%v) = %v, want %v", tt.name, tt.metric, tt.cur, got[tt.metric], tt.want)
+		}
+	}
+
+	// held values do not creep: each sample is compared to what is shown
+	for _, v := range []float64{42, 43, 44, 44.9} {
+		if got := g.hold(map[string]float64{MetricCPU: v})[MetricCPU]; got != 40 {
+			t.Fatalf("hold(cpu=%v) = %v, want 40", v, got)
+		}
+	}
+	g.commit(map[string]float64{MetricCPU: 45})
+	if got := g.hold(map[string]float64{MetricCPU: 41})[MetricCPU]; got != 45 {
+		t.Errorf("after commit, hold(cpu=41) = %v, want 45", got)
+	}
+}
+
+func TestActivityEqual(t *testing.T) {
+	at := func(sec int64) *time.Time {
+		tm := time.Unix(sec, 0)
+		return &tm
+	}
+	base := func() *client.Activity {
+		return &client.Activity{
+			Details:    "CPU 10%",
+			State:      "RAM 20%",
+			LargeImage: "arch",
+			SmallImage: "dot",
+			Timestamps: &client.Timestamps{Start: at(100)},
+			Buttons:    []*client.Button{{Label: "Report", Url: "https://p.example/a"}},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(a *client.Activity)
+		want   bool
+	}{
+		{"same", func(a *client.Activity) {}, true},
+		{"details", func(a *client.Activity) { a.Details = "CPU 11%" }, false},
+		{"small text", func(a *client.Activity) { a.SmallText = "x" }, false},
+		{"start under a millisecond", func(a *client.Activity) {
+			tm := a.Timestamps.Start.Add(time.Microsecond)
+			a.Timestamps.Start = &tm
+		}, true},
+		{"start", func(a *client.Activity) { a.Timestamps.Start = at(101) }, false},
+		{"end added", func(a *client.Activity) { a.Timestamps.End = at(200) }, false},
+		{"timestamps dropped", func(a *client.Activity) { a.Timestamps = nil }, false},
+		{"party added", func(a *client.Activity) { a.Party = &client.Party{ID: "p"} }, false},
+		{"secrets added", func(a *client.Activity) { a.Secrets = &client.Secrets{Join: "j"} }, false},
+		{"button url", func(a *client.Activity) { a.Buttons[0].Url = "https://p.example/b" }, false},
+		{"button added", func(a *client.Activity) {
+			a.Buttons = append(a.Buttons, &client.Button{Label: "More", Url: "https://p.example/c"})
+		}, false},
+	}
+	for _, tt := range tests {
+		a, b := base(), base()
+		tt.change(b)
+		if got := ActivityEqual(a, b); got != tt.want {
+			t.Errorf("%s: ActivityEqual = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := ActivityEqual(b, a); got != tt.want {
+			t.Errorf("%s, swapped: ActivityEqual = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !ActivityEqual(nil, nil) {
+		t.Error("ActivityEqual(nil, nil) = false")
+	}
+	if ActivityEqual(base(), nil) || ActivityEqual(nil, base()) {
+		t.Error("an activity equals nil")
+	}
+}
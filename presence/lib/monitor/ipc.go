@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+
+	"example.com/presence/lib/client"
+)
+
+// IPC is a Client for the Discord app running on this machine. It logs in
+// on first use and again after the connection was lost. The client
+// package holds a single connection, so a process has at most one IPC.
+type IPC struct {
+	ClientID string
+
+	connected bool
+}
+
+// SetActivity implements Client.
+func (c *IPC) SetActivity(ctx context.Context, act client.Activity) error {
+	if !c.connected {
+		if err := client.Login(ctx, c.ClientID); err != nil {
+			return err
+		}
+		c.connected = true
+	}
+	err := client.SetActivity(ctx, act)
+	if errors.Is(err, client.ErrNotConnected) || errors.Is(err, client.ErrClosed) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		// start over with the next activity
+		client.Logout()
+		c.connected = false
+	}
+	return err
+}
+
+// Close closes the connection, which also clears the activity.
+func (c *IPC) Close() error {
+	if !c.connected {
+		return nil
+	}
+	c.connected = false
+	return client.Logout()
+}
@@ -0,0 +1,371 @@
+// Package monitor publishes live system stats as a Discord presence.
+// A Monitor samples its providers on every tick, smooths the values, holds
+// back changes below their threshold, renders its templates and hands the
+// activity to its client whenever it differs from the last one sent:
+//
+//	discord := &monitor.IPC{ClientID: "1234567890123456789"}
+//	defer discord.Close()
+//	m, err := monitor.New(monitor.Config{Client: discord})
+//	if err != nil {
+//		return err
+//	}
+//	return m.Run(ctx)
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"example.com/presence/lib/client"
+)
+
+// DefaultInterval is the time between samples when Config leaves it zero.
+const DefaultInterval = 10 * time.Second
+
+// Client publishes the activities a Monitor renders.
+type Client interface {
+	SetActivity(ctx context.Context, act client.Activity) error
+}
+
+// Config configures a Monitor. Only Client is needed to run one.
+type Config struct {
+	// Client receives the activities. Render works without one.
+	Client Client
+	// Providers supply the metrics; nil means DefaultProviders over
+	// every interface but those in DefaultNetExclude.
+	Providers []Provider
+	// Templates render the text fields, DefaultTemplates if left zero.
+	Templates Templates
+	// Thresholds hold back changes too small to be worth an update, by
+	// metric name. Per-interface metrics fall back to their base
+	// metric's threshold; metrics without one show every change.
+	Thresholds map[string]Threshold
+	// Smoothing is the EWMA weight of each new sample, between 0 and 1;
+	// 0 turns smoothing off.
+	Smoothing float64
+	// Interval is the time between samples, DefaultInterval if zero.
+	Interval time.Duration
+	// SeriesLen is how many recent samples of each metric are kept for
+	// sparklines, DefaultSeriesLen if zero.
+	SeriesLen int
+	// Static and StaticDetails are handed to the templates as they are.
+	Static        map[string]string
+	StaticDetails string
+	// LargeImage and SmallImage are asset keys of the application.
+	LargeImage, SmallImage string
+	// ButtonURL is where the button labelled by Templates.Button leads;
+	// without one the activity has no button.
+	ButtonURL string
+	// Transform, if set, edits every rendered activity before it is
+	// compared with the last one and sent, e.g. to redact it.
+	Transform func(*client.Activity)
+	// History, if set, records every sample before smoothing and is
+	// what the templates see as .History.
+	History History
+	// Logger, if set, receives failed samples, renders and sends.
+	Logger *slog.Logger
+}
+
+// Snapshot is the state of a Monitor at one point in time.
+type Snapshot struct {
+	// Sampled is when Values were read. Values are the latest smoothed
+	// readings, Shown the ones behind Activity.
+	Sampled time.Time
+	Values  map[string]float64
+	Shown   map[string]float64
+	// Activity is the last activity the client accepted, nil if none.
+	Activity *client.Activity
+	// Err is the last failure, cleared when an activity is sent.
+	Err error
+}
+
+// Monitor keeps a presence updated with system stats. The goroutine in
+// Run owns the providers, smoothing and thresholds; the other methods may
+// be called from any goroutine.
+type Monitor struct {
+	client        Client
+	providers     []Provider
+	interval      time.Duration
+	seriesLen     int
+	smooth        *ewma
+	gate          *changeGate
+	static        map[string]string
+	staticDetails string
+	largeImage    string
+	smallImage    string
+	transform     func(*client.Activity)
+	history       History
+	logger        *slog.Logger
+	// the elapsed timer counts from New; resetting it on every update
+	// would make each activity differ from the last one sent
+	started time.Time
+	refresh chan struct{}
+	check   chan chan struct{}
+
+	mu        sync.Mutex
+	renderer  *Renderer
+	buttonURL string
+	snap      Snapshot
+	series    map[string]*ring
+}
+
+// New returns a Monitor for cfg. The default providers take their
+// baseline here, so the first sample measures the first interval.
+func New(cfg Config) (*Monitor, error) {
+	t := cfg.Templates
+	if t == (Templates{}) {
+		t = DefaultTemplates
+	}
+	r, err := ParseTemplates(t)
+	if err != nil {
+		return nil, err
+	}
+	providers := cfg.Providers
+	if providers == nil {
+		providers = DefaultProviders(NetworkConfig{Exclude: DefaultNetExclude})
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	seriesLen := cfg.SeriesLen
+	if seriesLen <= 0 {
+		seriesLen = DefaultSeriesLen
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return &Monitor{
+		client:        cfg.Client,
+		providers:     providers,
+		interval:      interval,
+		seriesLen:     seriesLen,
+		smooth:        newEWMA(cfg.Smoothing),
+		gate:          newChangeGate(cfg.Thresholds),
+		static:        cfg.Static,
+		staticDetails: cfg.StaticDetails,
+		largeImage:    cfg.LargeImage,
+		smallImage:    cfg.SmallImage,
+		transform:     cfg.Transform,
+		history:       cfg.History,
+		logger:        logger,
+		started:       time.Now(),
+		refresh:       make(chan struct{}, 1),
+		check:         make(chan chan struct{}),
+		renderer:      r,
+		buttonURL:     cfg.ButtonURL,
+		series:        map[string]*ring{},
+	}, nil
+}
+
+// Run samples and publishes until ctx is done, then returns nil. A failed
+// send is retried with the next sample.
+func (m *Monitor) Run(ctx context.Context) error {
+	if m.client == nil {
+		return errors.New("monitor: no client configured")
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.refresh:
+			m.publish(ctx)
+		case done := <-m.check:
+			close(done)
+		case <-ticker.C:
+			if m.sample(ctx) {
+				m.publish(ctx)
+			}
+		}
+	}
+}
+
+// Snapshot returns the latest sample and what was last sent.
+func (m *Monitor) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.snap
+	s.Values = maps.Clone(s.Values)
+	s.Shown = maps.Clone(s.Shown)
+	return s
+}
+
+// SetTemplates replaces the templates and republishes the latest sample.
+func (m *Monitor) SetTemplates(t Templates) error {
+	r, err := ParseTemplates(t)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.renderer = r
+	m.mu.Unlock()
+	m.Refresh()
+	return nil
+}
+
+// SetButtonURL sets where the button leads, or removes the button if url
+// is empty, and republishes the latest sample.
+func (m *Monitor) SetButtonURL(url string) {
+	m.mu.Lock()
+	m.buttonURL = url
+	m.mu.Unlock()
+	m.Refresh()
+}
+
+// Check waits for Run to come round its loop, so a watchdog can tell a
+// stuck monitor from an idle one. It fails if ctx is done first.
+func (m *Monitor) Check(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case m.check <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
+
+// Refresh asks Run to render and publish the latest sample again without
+// waiting for the next one. A refresh already pending covers this one too.
+func (m *Monitor) Refresh() {
+	select {
+	case m.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Render returns the activity for vals with the current templates and
+// button, after Transform. It sends nothing.
+func (m *Monitor) Render(vals map[string]float64) (client.Activity, error) {
+	m.mu.Lock()
+	r, url := m.renderer, m.buttonURL
+	series := make(map[string][]float64, len(m.series))
+	for k, s := range m.series {
+		series[k] = s.values()
+	}
+	m.mu.Unlock()
+	data := NewData(vals, m.static, m.staticDetails)
+	data.Series = series
+	if m.history != nil {
+		data.History = m.history
+	}
+	text, err := r.Render(data)
+	if err != nil {
+		return client.Activity{}, err
+	}
+	start := m.started
+	act := client.Activity{
+		Details:    text.Details,
+		State:      text.State,
+		LargeImage: m.largeImage,
+		LargeText:  text.LargeText,
+		SmallImage: m.smallImage,
+		SmallText:  text.SmallText,
+		Timestamps: &client.Timestamps{Start: &start},
+	}
+	if url != "" && text.Button != "" {
+		act.Buttons = []*client.Button{
+			{Label: text.Button, Url: url},
+		}
+	}
+	if m.transform != nil {
+		m.transform(&act)
+	}
+	return act, nil
+}
+
+// sample collects and smooths a new sample, reporting whether it got one.
+// A provider that fails does not hold back the others: their values are
+// used and the error is recorded; only a sample with no values at all is
+// dropped.
+func (m *Monitor) sample(ctx context.Context) bool {
+	vals, err := Collect(ctx, m.providers)
+	if err != nil {
+		m.logger.Warn("sample failed", "err", err)
+		m.setErr(err)
+		if len(vals) == 0 {
+			return false
+		}
+	}
+	now := time.Now()
+	if m.history != nil {
+		if err := m.history.Append(now, maps.Clone(vals)); err != nil {
+			m.logger.Warn("history not written", "err", err)
+		}
+	}
+	m.smooth.apply(vals)
+	m.mu.Lock()
+	m.snap.Values = vals
+	m.snap.Sampled = now
+	for k, v := range vals {
+		s, ok := m.series[k]
+		if !ok {
+			s = newRing(m.seriesLen)
+			m.series[k] = s
+		}
+		s.push(v)
+	}
+	// interfaces that went away take their series with them; after a
+	// failed provider its metrics are only missing for now
+	if err == nil {
+		for k := range m.series {
+			if _, ok := vals[k]; !ok {
+				delete(m.series, k)
+			}
+		}
+	}
+	m.mu.Unlock()
+	return true
+}
+
+// publish renders the latest sample and sends it if the client does not
+// have it yet. Metrics that did not move past their threshold keep the
+// value already on screen, so the text only changes when it changes
+// meaningfully.
+func (m *Monitor) publish(ctx context.Context) {
+	m.mu.Lock()
+	sample, sent := m.snap.Values, m.snap.Activity
+	m.mu.Unlock()
+	if sample == nil {
+		// nothing sampled yet; the first tick will publish
+		return
+	}
+	vals := m.gate.hold(sample)
+	act, err := m.Render(vals)
+	if err != nil {
+		m.logger.Error("render failed", "err", err)
+		m.setErr(err)
+		return
+	}
+	if ActivityEqual(&act, sent) {
+		return
+	}
+	if err := m.client.SetActivity(ctx, act); err != nil {
+		if ctx.Err() != nil {
+			// Run is stopping; the send was cut short on purpose
+			return
+		}
+		m.logger.Warn("activity not sent", "err", err)
+		m.setErr(err)
+		return
+	}
+	m.gate.commit(vals)
+	m.mu.Lock()
+	m.snap.Shown = vals
+	m.snap.Activity = &act
+	m.snap.Err = nil
+	m.mu.Unlock()
+}
+
+func (m *Monitor) setErr(err error) {
+	m.mu.Lock()
+	m.snap.Err = err
+	m.mu.Unlock()
+}
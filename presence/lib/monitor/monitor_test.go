@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/cpu"
+)
+
+func fixed(vals map[string]float64, err error) Provider {
+	return ProviderFunc(func(context.Context) (map[string]float64, error) {
+		return vals, err
+	})
+}
+
+func TestSamplePartial(t *testing.T) {
+	netErr := errors.New("net read failed")
+	tests := []struct {
+		name      string
+		providers []Provider
+		wantOK    bool
+		want      map[string]float64
+		wantErr   error
+	}{
+		{
+			name:      "all answer",
+			providers: []Provider{fixed(map[string]float64{MetricCPU: 10}, nil), fixed(map[string]float64{MetricNetRx: 5}, nil)},
+			wantOK:    true,
+			want:      map[string]float64{MetricCPU: 10, MetricNetRx: 5},
+		},
+		{
+			name:      "one fails",
+			providers: []Provider{fixed(map[string]float64{MetricCPU: 10}, nil), fixed(nil, netErr)},
+			wantOK:    true,
+			want:      map[string]float64{MetricCPU: 10},
+			wantErr:   netErr,
+		},
+		{
+			name:      "all fail",
+			providers: []Provider{fixed(nil, netErr)},
+			wantErr:   netErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(Config{Providers: tt.providers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok := m.sample(context.Background()); ok != tt.wantOK {
+				t.Fatalf("sample() = %v, want %v", ok, tt.wantOK)
+			}
+			snap := m.Snapshot()
+			if !errors.Is(snap.Err, tt.wantErr) || (tt.wantErr == nil) != (snap.Err == nil) {
+				t.Errorf("Err = %v, want %v", snap.Err, tt.wantErr)
+			}
+			if len(snap.Values) != len(tt.want) {
+				t.Fatalf("Values = %v, want %v", snap.Values, tt.want)
+			}
+			for k, v := range tt.want {
+				if snap.Values[k] != v {
+					t.Errorf("Values[%s] = %v, want %v", k, snap.Values[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleKeepsSeriesOfFailedProvider(t *testing.T) {
+	var netErr error
+	net := ProviderFunc(func(context.Context) (map[string]float64, error) {
+		if netErr != nil {
+			return nil, netErr
+		}
+		return map[string]float64{MetricNetRx: 1, MetricNetRx + ".eth0": 1}, nil
+	})
+	m, err := New(Config{Providers: []Provider{fixed(map[string]float64{MetricCPU: 1}, nil), net}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	m.sample(ctx)
+	netErr = errors.New("net read failed")
+	m.sample(ctx)
+	if _, ok := m.series[MetricNetRx+".eth0"]; !ok {
+		t.Error("a failed sample dropped the series of its interfaces")
+	}
+	if got := len(m.series[MetricCPU].values()); got != 2 {
+		t.Errorf("cpu series has %d samples, want 2", got)
+	}
+}
+
+func TestCPUBusy(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur cpu.TimesStat
+		want      float64
+	}{
+		{"idle", cpu.TimesStat{User: 10, Idle: 90}, cpu.TimesStat{User: 10, Idle: 190}, 0},
+		{"quarter", cpu.TimesStat{User: 10, Idle: 90}, cpu.TimesStat{User: 30, System: 5, Idle: 165}, 25},
+		{"all busy", cpu.TimesStat{User: 10, Idle: 90}, cpu.TimesStat{User: 60, Iowait: 50, Idle: 90}, 100},
+		{"from zero", cpu.TimesStat{}, cpu.TimesStat{User: 1, Idle: 3}, 25},
+		{"counters went back", cpu.TimesStat{User: 50, Idle: 50}, cpu.TimesStat{User: 10, Idle: 10}, 0},
+	}
+	for _, tt := range tests {
+		if got := cpuBusy(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s: cpuBusy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"context"
+	"math"
+	"path"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/net"
+)
+
+// NetworkConfig selects which interfaces count towards network throughput.
+// Patterns use path.Match syntax ("eth*", "wl?0"). An empty Include
+// selects every interface; Exclude always wins.
+type NetworkConfig struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// DefaultNetExclude skips loopback and the usual virtual bridges, which
+// would otherwise double count container and VM traffic.
+var DefaultNetExclude = []string{"lo", "docker*", "br-*", "veth*", "virbr*", "vnet*"}
+
+// netRate is the throughput of one interface (or the aggregate) in bytes/s.
+type netRate struct {
+	Rx, Tx float64
+}
+
+// netSampler turns the cumulative per-interface counters into rates.
+type netSampler struct {
+	cfg      NetworkConfig
+	prev     map[string]psnet.IOCountersStat
+	prevTime time.Time
+}
+
+func newNetSampler(cfg NetworkConfig) *netSampler {
+	return &netSampler{cfg: cfg}
+}
+
+func (s *netSampler) selected(name string) bool {
+	for _, p := range s.cfg.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(s.cfg.Include) == 0 {
+		return true
+	}
+	for _, p := range s.cfg.Include {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sample reads the counters and returns the rate of every selected
+// interface since the previous call. Interfaces that appeared since then
+// have no baseline yet and are left out until the next call; interfaces
+// that disappeared are simply dropped.
+func (s *netSampler) sample(ctx context.Context) (map[string]netRate, error) {
+	counters, err := psnet.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.update(counters, time.Now()), nil
+}
+
+// update records counters read at now and returns the rates since the
+// previous call.
+func (s *netSampler) update(counters []psnet.IOCountersStat, now time.Time) map[string]netRate {
+	cur := make(map[string]psnet.IOCountersStat, len(counters))
+	for _, c := range counters {
+		if s.selected(c.Name) {
+			cur[c.Name] = c
+		}
+	}
+
+	rates := map[string]netRate{}
+	interval := now.Sub(s.prevTime).Seconds()
+	if s.prev != nil && interval > 0 {
+		for name, c := range cur {
+			p, ok := s.prev[name]
+			if !ok {
+				continue
+			}
+			rates[name] = netRate{
+				Rx: float64(counterDelta(p.BytesRecv, c.BytesRecv)) / interval,
+				Tx: float64(counterDelta(p.BytesSent, c.BytesSent)) / interval,
+			}
+		}
+	}
+	s.prev = cur
+	s.prevTime = now
+	return rates
+}
+
+// counterDelta returns how far a cumulative counter moved. Some drivers
+// still expose 32-bit counters, so one that went backwards from a value
+// that fits in 32 bits wrapped, and the delta runs through 1<<32. Any
+// other decrease means the counter was reset, most often because the
+// interface was re-created; that has no usable baseline and counts as
+// zero, and the next sample measures from the new value.
+func counterDelta(prev, cur uint64) uint64 {
+	switch {
+	case cur >= prev:
+		return cur - prev
+	case prev <= math.MaxUint32:
+		return cur + (1<<32 - prev)
+	}
+	return 0
+}
+
+// sumRates aggregates the per-interface rates.
+func sumRates(rates map[string]netRate) netRate {
+	var total netRate
+	for _, r := range rates {
+		total.Rx += r.Rx
+		total.Tx += r.Tx
+	}
+	return total
+}
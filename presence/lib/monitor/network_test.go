@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/net"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		want      uint64
+	}{
+		{"unchanged", 100, 100, 0},
+		{"forward", 100, 250, 150},
+		{"forward past 32 bits", math.MaxUint32 - 10, math.MaxUint32 + 10, 20},
+		{"32-bit wrap", math.MaxUint32 - 9, 5, 15},
+		{"32-bit wrap from the top", math.MaxUint32, 0, 1},
+		{"reset of a 64-bit counter", 1 << 40, 1000, 0},
+		{"reset to zero", 1 << 33, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s: counterDelta(%d, %d) = %d, want %d", tt.name, tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
+
+func counters(m map[string][2]uint64) []psnet.IOCountersStat {
+	var out []psnet.IOCountersStat
+	for name, c := range m {
+		out = append(out, psnet.IOCountersStat{Name: name, BytesRecv: c[0], BytesSent: c[1]})
+	}
+	return out
+}
+
+func TestNetSampler(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name string
+		in   map[string][2]uint64
+		want map[string]netRate
+	}{
+		{
+			name: "first call has no baseline",
+			in:   map[string][2]uint64{"eth0": {1000, 500}, "lo": {9, 9}},
+			want: map[string]netRate{},
+		},
+		{
+			name: "rates per second, lo excluded",
+			in:   map[string][2]uint64{"eth0": {3000, 1500}, "lo": {99, 99}},
+			want: map[string]netRate{"eth0": {Rx: 1000, Tx: 500}},
+		},
+		{
+			name: "new interface waits for its baseline",
+			in:   map[string][2]uint64{"eth0": {3000, 1500}, "wlan0": {10, 10}},
+			want: map[string]netRate{"eth0": {}},
+		},
+		{
+			name: "interface gone",
+			in:   map[string][2]uint64{"wlan0": {2010, 10}},
+			want: map[string]netRate{"wlan0": {Rx: 1000}},
+		},
+		{
+			name: "interface back",
+			in:   map[string][2]uint64{"eth0": {1 << 40, 1 << 40}, "wlan0": {2010, 10}},
+			want: map[string]netRate{"wlan0": {}},
+		},
+		{
+			name: "re-created interface resets",
+			in:   map[string][2]uint64{"eth0": {400, 200}, "wlan0": {2010, 10}},
+			want: map[string]netRate{"eth0": {}, "wlan0": {}},
+		},
+		{
+			name: "and counts from its new value",
+			in:   map[string][2]uint64{"eth0": {800, 400}, "wlan0": {2010, 10}},
+			want: map[string]netRate{"eth0": {Rx: 200, Tx: 100}, "wlan0": {}},
+		},
+		{
+			name: "32-bit wrap keeps the traffic",
+			in:   map[string][2]uint64{"eth0": {800, 400}, "wlan0": {1990, 10}},
+			want: map[string]netRate{"eth0": {}, "wlan0": {Rx: (1<<32 - 20) / 2}},
+		},
+	}
+	s := newNetSampler(NetworkConfig{Exclude: DefaultNetExclude})
+	for i, step := range steps {
+		got := s.update(counters(step.in), start.Add(time.Duration(i)*2*time.Second))
+		if len(got) != len(step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+		for name, want := range step.want {
+			if got[name] != want {
+				t.Errorf("%s: %s = %+v, want %+v", step.name, name, got[name], want)
+			}
+		}
+	}
+}
+
+func TestNetSamplerSelection(t *testing.T) {
+	tests := []struct {
+		cfg  NetworkConfig
+		name string
+		want bool
+	}{
+		{NetworkConfig{}, "lo", true},
+		{NetworkConfig{Exclude: DefaultNetExclude}, "lo", false},
+		{NetworkConfig{Exclude: DefaultNetExclude}, "docker0", false},
+		{NetworkConfig{Exclude: DefaultNetExclude}, "enp3s0", true},
+		{NetworkConfig{Include: []string{"wl*"}}, "wlan0", true},
+		{NetworkConfig{Include: []string{"wl*"}}, "eth0", false},
+		{NetworkConfig{Include: []string{"*"}, Exclude: []string{"eth0"}}, "eth0", false},
+	}
+	for _, tt := range tests {
+		if got := newNetSampler(tt.cfg).selected(tt.name); got != tt.want {
+			t.Errorf("%+v selected(%q) = %v, want %v", tt.cfg, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// Provider supplies metric values. Sample returns the current value of
+// every metric it knows, keyed by metric name; names should not collide
+// with those of other providers.
+type Provider interface {
+	Sample(ctx context.Context) (map[string]float64, error)
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context) (map[string]float64, error)
+
+func (f ProviderFunc) Sample(ctx context.Context) (map[string]float64, error) { return f(ctx) }
+
+// CPU reports overall CPU usage in percent as MetricCPU, measured since
+// the previous sample, or since CPU was called for the first one. Each
+// provider keeps its own baseline, so creating another one, say for a
+// new profile, does not skew the readings of this one.
+func CPU() Provider {
+	var prev cpu.TimesStat
+	if t, err := cpu.Times(false); err == nil && len(t) > 0 {
+		prev = t[0]
+	}
+	return ProviderFunc(func(ctx context.Context) (map[string]float64, error) {
+		t, err := cpu.TimesWithContext(ctx, false)
+		if err != nil || len(t) == 0 {
+			return nil, fmt.Errorf("cpu read failed: %v", err)
+		}
+		pct := cpuBusy(prev, t[0])
+		prev = t[0]
+		return map[string]float64{MetricCPU: pct}, nil
+	})
+}
+
+// cpuBusy returns the share of CPU time spent busy between two readings
+// of the counters, in percent, the way cpu.Percent computes it.
+func cpuBusy(prev, cur cpu.TimesStat) float64 {
+	busy := func(t cpu.TimesStat) (all, busy float64) {
+		b := t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+		return b + t.Idle, b
+	}
+	prevAll, prevBusy := busy(prev)
+	curAll, curBusy := busy(cur)
+	switch {
+	case curBusy <= prevBusy:
+		return 0
+	case curAll <= prevAll:
+		return 100
+	}
+	return min(100, max(0, (curBusy-prevBusy)/(curAll-prevAll)*100))
+}
+
+// Memory reports used memory in percent as MetricRAM.
+func Memory() Provider {
+	return ProviderFunc(func(ctx context.Context) (map[string]float64, error) {
+		vm, err := mem.VirtualMemoryWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("mem read failed: %w", err)
+		}
+		return map[string]float64{MetricRAM: vm.UsedPercent}, nil
+	})
+}
+
+// Network reports the throughput of the interfaces cfg selects in bytes/s,
+// summed as MetricNetRx and MetricNetTx and per interface. Like CPU, the
+// first sample is measured from the call to Network.
+func Network(cfg NetworkConfig) Provider {
+	s := newNetSampler(cfg)
+	// without a baseline the first sample reads as idle
+	_, _ = s.sample(context.Background())
+	return ProviderFunc(func(ctx context.Context) (map[string]float64, error) {
+		rates, err := s.sample(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("net read failed: %w", err)
+		}
+		total := sumRates(rates)
+		vals := map[string]float64{MetricNetRx: total.Rx, MetricNetTx: total.Tx}
+		for name, r := range rates {
+			vals[MetricNetRx+"."+name] = r.Rx
+			vals[MetricNetTx+"."+name] = r.Tx
+		}
+		return vals, nil
+	})
+}
+
+// DefaultProviders returns the CPU, memory and network providers.
+func DefaultProviders(net NetworkConfig) []Provider {
+	return []Provider{CPU(), Memory(), Network(net)}
+}
+
+// Collect samples every provider and merges the values. If any of them
+// fails the error says which, and the values of the others are still
+// returned.
+func Collect(ctx context.Context, providers []Provider) (map[string]float64, error) {
+	vals := map[string]float64{}
+	var errs []error
+	for _, p := range providers {
+		v, err := p.Sample(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for k, x := range v {
+			vals[k] = x
+		}
+	}
+	return vals, errors.Join(errs...)
+}
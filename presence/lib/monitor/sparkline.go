@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultSeriesLen is how many recent samples of each metric a Monitor
+// keeps for sparklines when Config leaves SeriesLen zero.
+const DefaultSeriesLen = 32
+
+// sparkBlocks are the eight heights of a sparkline, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// ring keeps the last len(buf) samples of one metric.
+type ring struct {
+	buf  []float64
+	next int
+	full bool
+}
+
+func newRing(n int) *ring { return &ring{buf: make([]float64, n)} }
+
+func (r *ring) push(v float64) {
+	r.buf[r.next] = v
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// values returns the samples oldest first, in a new slice.
+func (r *ring) values() []float64 {
+	if !r.full {
+		return append([]float64(nil), r.buf[:r.next]...)
+	}
+	return append(append([]float64(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// Sparkline draws the last width values as block characters, one rune
+// each. Heights run from zero to scale, or to the highest value shown if
+// scale is not positive; negative and NaN values draw as the lowest
+// block. width is capped at TextMaxRunes, so the line always fits a field.
+func Sparkline(values []float64, width int, scale float64) string {
+	width = min(width, TextMaxRunes)
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	if scale <= 0 {
+		// not math.Max, which would let one NaN flatten the line
+		for _, v := range values {
+			if v > scale {
+				scale = v
+			}
+		}
+	}
+	var b strings.Builder
+	top := len(sparkBlocks) - 1
+	for _, v := range values {
+		i := 0
+		if scale > 0 && v > 0 {
+			i = min(int(math.Round(v/scale*float64(top))), top)
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// sparklineFunc is Sparkline for templates, where the scale is optional:
+// {{sparkline .Series.cpu 16 100}} or {{sparkline .Series.net_rx 16}}.
+func sparklineFunc(values []float64, width int, scale ...float64) (string, error) {
+	switch len(scale) {
+	case 0:
+		return Sparkline(values, width, 0), nil
+	case 1:
+		return Sparkline(values, width, scale[0]), nil
+	}
+	return "", fmt.Errorf("sparkline: want at most one scale, got %d", len(scale))
+}
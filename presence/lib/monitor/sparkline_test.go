@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		push []float64
+		want []float64
+	}{
+		{"empty", 3, nil, nil},
+		{"partly filled", 3, []float64{1, 2}, []float64{1, 2}},
+		{"exactly full", 3, []float64{1, 2, 3}, []float64{1, 2, 3}},
+		{"wrapped once", 3, []float64{1, 2, 3, 4}, []float64{2, 3, 4}},
+		{"wrapped twice", 3, []float64{1, 2, 3, 4, 5, 6, 7}, []float64{5, 6, 7}},
+		{"single slot", 1, []float64{1, 2}, []float64{2}},
+	}
+	for _, tt := range tests {
+		r := newRing(tt.size)
+		for _, v := range tt.push {
+			r.push(v)
+		}
+		got := r.values()
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: values() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// values is a copy; the next push must not show through
+	r := newRing(2)
+	r.push(1)
+	r.push(2)
+	got := r.values()
+	r.push(3)
+	if !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Errorf("values() changed under a push: %v", got)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		width  int
+		scale  float64
+		want   string
+	}{
+		{"empty", nil, 8, 0, ""},
+		{"empty with scale", []float64{}, 8, 100, ""},
+		{"zero width", []float64{1, 2}, 0, 0, ""},
+		{"ramp to own max", []float64{0, 1, 2, 3, 4, 5, 6, 7}, 8, 0, "▁▂▃▄▅▆▇█"},
+		{"fixed scale", []float64{0, 50, 100}, 8, 100, "▁▅█"},
+		{"over the scale is capped", []float64{200}, 8, 100, "█"},
+		{"negative is lowest", []float64{-5, 10}, 8, 0, "▁█"},
+		{"last width values", []float64{9, 9, 0, 7}, 2, 7, "▁█"},
+		{"flat", []float64{42, 42, 42}, 8, 0, "███"},
+		{"flat under a scale", []float64{50, 50}, 8, 100, "▅▅"},
+		{"flat at zero", []float64{0, 0, 0}, 8, 0, "▁▁▁"},
+		{"flat below zero", []float64{-3, -3}, 8, 0, "▁▁"},
+		{"NaN is lowest", []float64{math.NaN(), 8}, 8, 0, "▁█"},
+	}
+	for _, tt := range tests {
+		if got := Sparkline(tt.values, tt.width, tt.scale); got != tt.want {
+			t.Errorf("%s: Sparkline(%v, %d, %v) = %q, want %q", tt.name, tt.values, tt.width, tt.scale, got, tt.want)
+		}
+	}
+
+	long := make([]float64, 500)
+	if got := Sparkline(long, 500, 0); utf8.RuneCountInString(got) != TextMaxRunes || strings.Trim(got, "▁") != "" {
+		t.Errorf("Sparkline of 500 zeros is %d runes, want %d lowest blocks", utf8.RuneCountInString(got), TextMaxRunes)
+	}
+}
@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Templates are text/template sources for the text fields of the activity.
+// They are executed against Data.
+type Templates struct {
+	Details   string `json:"details"`
+	State     string `json:"state"`
+	LargeText string `json:"large_text"`
+	SmallText string `json:"small_text"`
+	// Button is the label of the report button.
+	Button string `json:"button"`
+}
+
+// DefaultTemplates show the fastfetch summary, CPU and RAM.
+var DefaultTemplates = Templates{
+	Details:   `{{.StaticDetails}}`,
+	State:     `CPU {{printf "%.0f" .CPU}}% • RAM {{printf "%.0f" .RAM}}%`,
+	LargeText: `{{or (index .Static "DE") (index .Static "WM")}}`,
+	SmallText: `{{printf "%.0f" .RAM}}% RAM`,
+	Button:    `Full fastfetch output`,
+}
+
+// WithDefaults fills the fields left empty in t from def.
+func (t Templates) WithDefaults(def Templates) Templates {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&t.Details, def.Details},
+		{&t.State, def.State},
+		{&t.LargeText, def.LargeText},
+		{&t.SmallText, def.SmallText},
+		{&t.Button, def.Button},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	return t
+}
+
+// Data is what the presence templates see.
+type Data struct {
+	CPU float64 // overall CPU usage in percent
+	RAM float64 // used memory in percent
+	// Net is the throughput summed over the selected interfaces,
+	// Ifaces the same per interface name.
+	Net    NetView
+	Ifaces map[string]NetView
+	// Values holds every metric by name, including those of custom
+	// providers: {{index .Values "gpu"}}.
+	Values map[string]float64
+	// Series holds the recent smoothed samples of every metric, oldest
+	// first, for sparklines: {{sparkline .Series.cpu 16 100}}.
+	Series map[string][]float64
+	// Static holds every fastfetch module by name, StaticDetails the
+	// short OS/Kernel/Packages/CPU/Memory summary and UserHost user@host.
+	Static        map[string]string
+	StaticDetails string
+	UserHost      string
+	// History answers questions about past samples when the monitor
+	// keeps one: {{.History.Avg "cpu" "today" | printf "%.0f"}}.
+	History History
+}
+
+// History stores raw samples and answers template queries about them.
+// Windows are "today", "yesterday", or a span back from now such as
+// "1h" or "7d"; *history.Store implements it.
+type History interface {
+	Append(t time.Time, vals map[string]float64) error
+	Avg(metric, window string) (float64, error)
+	Peak(metric, window string) (float64, error)
+	Streak() int
+}
+
+// errNoHistory fails templates that query a monitor without a history.
+var errNoHistory = errors.New("no history is kept; enable it in the config")
+
+type noHistory struct{}
+
+func (noHistory) Append(time.Time, map[string]float64) error { return nil }
+func (noHistory) Avg(string, string) (float64, error)        { return 0, errNoHistory }
+func (noHistory) Peak(string, string) (float64, error)       { return 0, errNoHistory }
+func (noHistory) Streak() int                                { return 0 }
+
+// NetView exposes a throughput to templates: {{.Net.RxRate}} gives "1.3 MiB/s".
+type NetView struct {
+	Rx, Tx float64 // bytes per second
+}
+
+func (v NetView) RxRate() string { return HumanBytes(uint64(v.Rx)) + "/s" }
+func (v NetView) TxRate() string { return HumanBytes(uint64(v.Tx)) + "/s" }
+
+// NewData assembles the template view of metric values and the static
+// fastfetch modules.
+func NewData(vals map[string]float64, static map[string]string, staticDetails string) Data {
+	d := Data{
+		CPU:           vals[MetricCPU],
+		RAM:           vals[MetricRAM],
+		Net:           NetView{Rx: vals[MetricNetRx], Tx: vals[MetricNetTx]},
+		Ifaces:        map[string]NetView{},
+		Values:        vals,
+		Static:        static,
+		StaticDetails: staticDetails,
+		UserHost:      static["UserHost"],
+		History:       noHistory{},
+	}
+	for k, v := range vals {
+		if name, ok := strings.CutPrefix(k, MetricNetRx+"."); ok {
+			iv := d.Ifaces[name]
+			iv.Rx = v
+			d.Ifaces[name] = iv
+		} else if name, ok := strings.CutPrefix(k, MetricNetTx+"."); ok {
+			iv := d.Ifaces[name]
+			iv.Tx = v
+			d.Ifaces[name] = iv
+		}
+	}
+	return d
+}
+
+// Funcs are the functions available to the templates.
+var Funcs = template.FuncMap{
+	"sparkline": sparklineFunc,
+	"humanBytes": func(v any) (string, error) {
+		switch n := v.(type) {
+		case float64:
+			return HumanBytes(uint64(n)), nil
+		case uint64:
+			return HumanBytes(n), nil
+		case int:
+			return HumanBytes(uint64(n)), nil
+		}
+		return "", fmt.Errorf("humanBytes: unsupported type %T", v)
+	},
+}
+
+// Renderer holds the parsed activity templates.
+type Renderer struct {
+	details, state, largeText, smallText, button *template.Template
+}
+
+// ParseTemplates parses every template in t.
+func ParseTemplates(t Templates) (*Renderer, error) {
+	var r Renderer
+	for _, f := range []struct {
+		name string
+		src  string
+		dst  **template.Template
+	}{
+		{"details", t.Details, &r.details},
+		{"state", t.State, &r.state},
+		{"large_text", t.LargeText, &r.largeText},
+		{"small_text", t.SmallText, &r.smallText},
+		{"button", t.Button, &r.button},
+	} {
+		tmpl, err := template.New(f.name).Funcs(Funcs).Option("missingkey=zero").Parse(f.src)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", f.name, err)
+		}
+		*f.dst = tmpl
+	}
+	return &r, nil
+}
+
+// Text holds the text fields of an activity.
+type Text struct {
+	Details, State, LargeText, SmallText, Button string
+}
+
+// Discord's length limits for activity text fields and button labels.
+const (
+	TextMaxRunes   = 128
+	ButtonMaxRunes = 32
+)
+
+// Render executes every template, truncating each field to the length
+// Discord accepts.
+func (r *Renderer) Render(data Data) (Text, error) {
+	var out Text
+	for _, f := range []struct {
+		tmpl *template.Template
+		dst  *string
+		max  int
+	}{
+		{r.details, &out.Details, TextMaxRunes},
+		{r.state, &out.State, TextMaxRunes},
+		{r.largeText, &out.LargeText, TextMaxRunes},
+		{r.smallText, &out.SmallText, TextMaxRunes},
+		{r.button, &out.Button, ButtonMaxRunes},
+	} {
+		var b strings.Builder
+		if err := f.tmpl.Execute(&b, data); err != nil {
+			return out, err
+		}
+		*f.dst = TruncateRunes(strings.TrimSpace(b.String()), f.max)
+	}
+	return out, nil
+}
+
+// TruncateRunes shortens s to at most n runes, ending in "..." if it was cut.
+func TruncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if n > 3 {
+		return string(r[:n-3]) + "..."
+	}
+	return string(r[:n])
+}
+
+// HumanBytes formats b with binary units: "512 B", "1.3 MiB".
+func HumanBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,176 @@
+package paste
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Deleter is implemented by backends that can take a paste down again.
+type Deleter interface {
+	Delete(ctx context.Context, url string) error
+}
+
+// Resolver is implemented by backends that know better than an HTTP HEAD
+// whether a paste still exists (e.g. LocalDir checks the file).
+type Resolver interface {
+	Resolves(ctx context.Context, url string) bool
+}
+
+// cacheEntry is the on-disk record of the last upload.
+type cacheEntry struct {
+	Hash     string    `json:"hash"`
+	URL      string    `json:"url"`
+	Backend  string    `json:"backend"`
+	Uploaded time.Time `json:"uploaded"`
+}
+
+// Cache puts an Uploader behind a content-addressed record on disk, so
+// the same text is only uploaded once for as long as its paste resolves.
+// When the text changes, the superseded paste is deleted if the backend
+// supports it. Deletions that fail are kept and retried by Flush.
+type Cache struct {
+	Uploader Uploader
+	// Backend names the uploader; entries written by another backend are
+	// never reused.
+	Backend string
+	// Path is the JSON file holding the last upload. If empty, nothing
+	// is kept and every Upload uploads.
+	Path   string
+	Client *http.Client
+
+	mu      sync.Mutex
+	pending []string
+}
+
+// Hash returns the cache key of text.
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Upload returns the URL of a confirmed paste of text: the cached one if
+// it still resolves, otherwise a fresh upload.
+func (c *Cache) Upload(ctx context.Context, text string) (string, error) {
+	hash := Hash(text)
+	prev, _ := c.load()
+	if prev != nil && prev.Backend == c.Backend && prev.Hash == hash && c.resolves(ctx, prev.URL) {
+		return prev.URL, nil
+	}
+
+	url, err := c.Uploader.Upload(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	if !c.resolves(ctx, url) {
+		return "", fmt.Errorf("paste: uploaded %s but it does not resolve", url)
+	}
+	if err := c.store(&cacheEntry{Hash: hash, URL: url, Backend: c.Backend, Uploaded: time.Now()}); err != nil {
+		return url, fmt.Errorf("paste: cache: %w", err)
+	}
+
+	if prev != nil && prev.Backend == c.Backend && prev.URL != url {
+		c.mu.Lock()
+		c.pending = append(c.pending, prev.URL)
+		c.mu.Unlock()
+		c.Flush(ctx)
+	}
+	return url, nil
+}
+
+// Flush deletes superseded pastes that are still waiting, returning the
+// first error. Failed deletions stay queued.
+func (c *Cache) Flush(ctx context.Context) error {
+	d, ok := c.Uploader.(Deleter)
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var first error
+	var failed []string
+	for _, url := range pending {
+		err := d.Delete(ctx, url)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			failed = append(failed, url)
+			if first == nil {
+				first = fmt.Errorf("paste: delete %s: %w", url, err)
+			}
+		}
+	}
+	c.mu.Lock()
+	c.pending = append(failed, c.pending...)
+	c.mu.Unlock()
+	return first
+}
+
+// Pending returns the number of deletions still waiting.
+func (c *Cache) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+func (c *Cache) resolves(ctx context.Context, url string) bool {
+	if r, ok := c.Uploader.(Resolver); ok {
+		return r.Resolves(ctx, url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient(c.Client).Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (c *Cache) load() (*cacheEntry, error) {
+	if c.Path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c *Cache) store(e *cacheEntry) error {
+	if c.Path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
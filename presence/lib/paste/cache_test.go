@@ -0,0 +1,141 @@
+package paste
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// flakyDeleter fails deletions while failing is set.
+type flakyDeleter struct {
+	*PasteRS
+	failing bool
+}
+
+func (f *flakyDeleter) Delete(ctx context.Context, url string) error {
+	if f.failing {
+		return errors.New("service unavailable")
+	}
+	return f.PasteRS.Delete(ctx, url)
+}
+
+func TestCacheReusesPaste(t *testing.T) {
+	s := newStandIn(t)
+	c := &Cache{Uploader: &PasteRS{Endpoint: s.URL()}, Backend: "paste.rs", Path: filepath.Join(t.TempDir(), "paste.json")}
+	ctx := context.Background()
+
+	first, err := c.Upload(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.Upload(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || s.Len() != 1 {
+		t.Errorf("same text gave %q, then %q, with %d pastes stored; want one", first, again, s.Len())
+	}
+
+	// a cache written for another backend is not reused
+	other := &Cache{Uploader: c.Uploader, Backend: "0x0", Path: c.Path}
+	if url, err := other.Upload(ctx, "report"); err != nil || url == first {
+		t.Errorf("other backend got %q, %v; want a fresh upload", url, err)
+	}
+}
+
+func TestCacheWithoutPath(t *testing.T) {
+	s := newStandIn(t)
+	c := &Cache{Uploader: &PasteRS{Endpoint: s.URL()}, Backend: "standin"}
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := c.Upload(ctx, "report"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Len() != 2 || c.Pending() != 0 {
+		t.Errorf("%d pastes stored, %d deletions pending; want 2 and none", s.Len(), c.Pending())
+	}
+}
+
+func TestCacheReuploadsWhenGone(t *testing.T) {
+	s := newStandIn(t)
+	up := &PasteRS{Endpoint: s.URL()}
+	c := &Cache{Uploader: up, Backend: "paste.rs", Path: filepath.Join(t.TempDir(), "paste.json")}
+	ctx := context.Background()
+
+	first, err := c.Upload(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := up.Delete(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Upload(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Errorf("got the deleted paste %q again", first)
+	}
+}
+
+func TestCacheDeletesSuperseded(t *testing.T) {
+	s := newStandIn(t)
+	up := &flakyDeleter{PasteRS: &PasteRS{Endpoint: s.URL()}}
+	c := &Cache{Uploader: up, Backend: "paste.rs", Path: filepath.Join(t.TempDir(), "paste.json")}
+	ctx := context.Background()
+
+	first, err := c.Upload(ctx, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deletion fails and waits in the queue
+	up.failing = true
+	second, err := c.Upload(ctx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("changed text gave the same URL %q", first)
+	}
+	if c.Pending() != 1 || s.Len() != 2 {
+		t.Fatalf("after a failed delete: %d pending, %d stored; want 1 and 2", c.Pending(), s.Len())
+	}
+	if err := c.Flush(ctx); err == nil {
+		t.Error("Flush succeeded while deletes fail")
+	}
+	if c.Pending() != 1 {
+		t.Fatalf("failed delete left %d pending, want 1", c.Pending())
+	}
+
+	up.failing = false
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Pending() != 0 || s.Len() != 1 {
+		t.Errorf("after Flush: %d pending, %d stored; want 0 and 1", c.Pending(), s.Len())
+	}
+	if code, _ := get(t, first); code != http.StatusNotFound {
+		t.Errorf("superseded paste answers %d, want 404", code)
+	}
+}
+
+func TestCacheWithoutDelete(t *testing.T) {
+	s := newStandIn(t)
+	c := &Cache{Uploader: &ZeroXZero{Endpoint: s.URL()}, Backend: "0x0", Path: filepath.Join(t.TempDir(), "paste.json")}
+	ctx := context.Background()
+	if _, err := c.Upload(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Upload(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+	// nothing can delete the old paste, so nothing waits to
+	if c.Pending() != 0 || s.Len() != 2 {
+		t.Errorf("%d pending, %d stored; want 0 and 2", c.Pending(), s.Len())
+	}
+}
@@ -0,0 +1,110 @@
+package paste
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// HTTP uploads to an arbitrary endpoint. The text is sent as the raw body,
+// or as a multipart form file when Field is set. The resulting URL is read
+// from the ResponseHeader header, the ResponseJSON field of a JSON body
+// (dotted for nested objects, e.g. "data.url"), or else the body itself.
+// With DeleteMethod set, superseded pastes are removed by sending that
+// method to the paste URL, with the same Headers.
+type HTTP struct {
+	URL            string
+	Method         string // POST if empty
+	Headers        map[string]string
+	Field          string
+	ResponseJSON   string
+	ResponseHeader string
+	DeleteMethod   string
+	Client         *http.Client
+}
+
+func (h *HTTP) Upload(ctx context.Context, text string) (string, error) {
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	var (
+		body        io.Reader = strings.NewReader(text)
+		contentType           = "text/plain; charset=utf-8"
+	)
+	if h.Field != "" {
+		var err error
+		body, contentType, err = multipartBody(h.Field, "fastfetch.txt", text)
+		if err != nil {
+			return "", err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, b, err := do(h.Client, req)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case h.ResponseHeader != "":
+		return urlFromBody([]byte(resp.Header.Get(h.ResponseHeader)))
+	case h.ResponseJSON != "":
+		return urlFromJSON(b, h.ResponseJSON)
+	}
+	return urlFromBody(b)
+}
+
+func (h *HTTP) Delete(ctx context.Context, url string) error {
+	if h.DeleteMethod == "" {
+		return errors.ErrUnsupported
+	}
+	return deleteURL(ctx, h.Client, h.DeleteMethod, url, h.Headers)
+}
+
+// urlFromJSON looks up a dotted field path in a JSON object.
+func urlFromJSON(b []byte, field string) (string, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("parse response: %w", err)
+	}
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", ErrNoURL
+		}
+		v = obj[key]
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", ErrNoURL
+	}
+	return urlFromBody([]byte(s))
+}
+
+func multipartBody(field, filename, text string) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fw, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.WriteString(fw, text); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
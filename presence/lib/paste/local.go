@@ -0,0 +1,84 @@
+package paste
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalDir writes pastes into Dir, which some other web server publishes
+// under URLPrefix. Files are named after their content hash, so writing
+// the same text twice yields the same URL.
+type LocalDir struct {
+	Dir       string
+	URLPrefix string
+}
+
+func (l *LocalDir) Upload(ctx context.Context, text string) (string, error) {
+	if l.URLPrefix == "" {
+		return "", errors.New("paste: local backend needs a URL prefix")
+	}
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(text))
+	name := hex.EncodeToString(sum[:8]) + ".txt"
+
+	// write to a temp file first so the web server never serves half a paste
+	tmp, err := os.CreateTemp(l.Dir, ".paste-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(l.Dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return strings.TrimSuffix(l.URLPrefix, "/") + "/" + name, nil
+}
+
+// path maps a URL produced by Upload back to its file.
+func (l *LocalDir) path(url string) (string, bool) {
+	name, ok := strings.CutPrefix(url, strings.TrimSuffix(l.URLPrefix, "/")+"/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	return filepath.Join(l.Dir, name), true
+}
+
+func (l *LocalDir) Resolves(ctx context.Context, url string) bool {
+	p, ok := l.path(url)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func (l *LocalDir) Delete(ctx context.Context, url string) error {
+	p, ok := l.path(url)
+	if !ok {
+		return fmt.Errorf("paste: %s is not under %s", url, l.URLPrefix)
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
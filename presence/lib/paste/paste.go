@@ -0,0 +1,136 @@
+package paste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Uploader publishes text and returns a URL where it can be read.
+type Uploader interface {
+	Upload(ctx context.Context, text string) (string, error)
+}
+
+// ErrNoURL is returned when a backend answered but gave no usable URL.
+var ErrNoURL = errors.New("paste: response contained no URL")
+
+// maxResponse bounds how much of a response body is read.
+const maxResponse = 64 << 10
+
+// userAgent is sent with every request; some services reject requests without one.
+const userAgent = "presence-daemon"
+
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// do sends req and returns the response body, failing on anything but 200/201.
+func do(c *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient(c).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return resp, nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return resp, b, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, b, nil
+}
+
+// urlFromBody accepts a response body that is nothing but an http(s) URL.
+func urlFromBody(b []byte) (string, error) {
+	url := strings.TrimSpace(string(b))
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url, nil
+	}
+	return "", ErrNoURL
+}
+
+// PasteRS uploads to paste.rs, or anything speaking the same protocol:
+// POST the raw text, get the URL back as the body.
+type PasteRS struct {
+	Endpoint string // defaults to https://paste.rs
+	Client   *http.Client
+}
+
+func (p *PasteRS) endpoint() string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	return "https://paste.rs"
+}
+
+func (p *PasteRS) Upload(ctx context.Context, text string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint(), strings.NewReader(text))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	_, b, err := do(p.Client, req)
+	if err != nil {
+		return "", err
+	}
+	return urlFromBody(b)
+}
+
+// Delete takes a paste down; paste.rs accepts a plain DELETE on the paste URL.
+func (p *PasteRS) Delete(ctx context.Context, url string) error {
+	return deleteURL(ctx, p.Client, http.MethodDelete, url, nil)
+}
+
+// deleteURL sends a delete request; a paste that is already gone counts as deleted.
+func deleteURL(ctx context.Context, c *http.Client, method, url string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, _, err := do(c, req)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// ZeroXZero uploads to 0x0.st as a multipart "file" form field.
+type ZeroXZero struct {
+	Endpoint string // defaults to https://0x0.st
+	Client   *http.Client
+}
+
+func (z *ZeroXZero) endpoint() string {
+	if z.Endpoint != "" {
+		return z.Endpoint
+	}
+	return "https://0x0.st"
+}
+
+func (z *ZeroXZero) Upload(ctx context.Context, text string) (string, error) {
+	body, contentType, err := multipartBody("file", "fastfetch.txt", text)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, z.endpoint(), body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	_, b, err := do(z.Client, req)
+	if err != nil {
+		return "", err
+	}
+	return urlFromBody(b)
+}
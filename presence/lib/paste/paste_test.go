@@ -0,0 +1,181 @@
+package paste
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newStandIn serves a StandIn through httptest.
+func newStandIn(t *testing.T) *StandIn {
+	t.Helper()
+	s := &StandIn{pastes: map[string]string{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	s.base = srv.URL
+	return s
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestBackendsAgainstStandIn(t *testing.T) {
+	s := newStandIn(t)
+	tests := []struct {
+		name string
+		up   Uploader
+	}{
+		{"paste.rs", &PasteRS{Endpoint: s.URL()}},
+		{"0x0", &ZeroXZero{Endpoint: s.URL()}},
+		{"http raw", &HTTP{URL: s.URL(), DeleteMethod: http.MethodDelete}},
+		{"http form", &HTTP{URL: s.URL(), Method: http.MethodPut, Field: "upload"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, err := tt.up.Upload(context.Background(), "hello\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(url, s.URL()+"/") {
+				t.Fatalf("got URL %q, want one under %s", url, s.URL())
+			}
+			if code, body := get(t, url); code != http.StatusOK || body != "hello\n" {
+				t.Fatalf("GET %s = %d %q, want 200 %q", url, code, body, "hello\n")
+			}
+			d, ok := tt.up.(Deleter)
+			if !ok {
+				return
+			}
+			switch err := d.Delete(context.Background(), url); {
+			case errors.Is(err, errors.ErrUnsupported):
+				return
+			case err != nil:
+				t.Fatalf("Delete: %v", err)
+			}
+			if code, _ := get(t, url); code != http.StatusNotFound {
+				t.Errorf("GET after Delete = %d, want 404", code)
+			}
+			// gone already counts as deleted
+			if err := d.Delete(context.Background(), url); err != nil {
+				t.Errorf("second Delete: %v", err)
+			}
+		})
+	}
+}
+
+func TestHTTPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		up      HTTP
+		status  int
+		header  string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{name: "body", status: 200, body: " https://p.example/a\n", want: "https://p.example/a"},
+		{name: "created", status: 201, body: "http://p.example/a", want: "http://p.example/a"},
+		{name: "body not a URL", status: 200, body: "ok", wantErr: ErrNoURL},
+		{name: "json", up: HTTP{ResponseJSON: "data.url"}, status: 200,
+			body: `{"data":{"url":"https://p.example/b"}}`, want: "https://p.example/b"},
+		{name: "json missing", up: HTTP{ResponseJSON: "data.url"}, status: 200,
+			body: `{"data":{}}`, wantErr: ErrNoURL},
+		{name: "json not an object", up: HTTP{ResponseJSON: "data.url"}, status: 200,
+			body: `{"data":"x"}`, wantErr: ErrNoURL},
+		{name: "header", up: HTTP{ResponseHeader: "Location"}, status: 201,
+			header: "https://p.example/c", body: "ignored", want: "https://p.example/c"},
+		{name: "server error", status: 500, body: "https://p.example/d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Location", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			up := tt.up
+			up.URL = srv.URL
+			got, err := up.Upload(context.Background(), "text")
+			switch {
+			case tt.want == "" && err == nil:
+				t.Fatalf("Upload = %q, want an error", got)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("Upload error = %v, want %v", err, tt.wantErr)
+			case tt.want != "" && (err != nil || got != tt.want):
+				t.Fatalf("Upload = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRequest(t *testing.T) {
+	var gotMethod, gotAuth, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotAuth, gotType = r.Method, r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		io.WriteString(w, "https://p.example/x")
+	}))
+	defer srv.Close()
+	up := &HTTP{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer t"}}
+	if _, err := up.Upload(context.Background(), "text"); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPost || gotAuth != "Bearer t" || !strings.HasPrefix(gotType, "text/plain") {
+		t.Errorf("got %s with Authorization %q and Content-Type %q", gotMethod, gotAuth, gotType)
+	}
+}
+
+func TestLocalDir(t *testing.T) {
+	l := &LocalDir{Dir: t.TempDir(), URLPrefix: "https://files.example/p/"}
+	ctx := context.Background()
+	a, err := l.Upload(ctx, "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a, "https://files.example/p/") || strings.Contains(a, "p//") {
+		t.Errorf("got URL %q", a)
+	}
+	if again, _ := l.Upload(ctx, "one"); again != a {
+		t.Errorf("same text gave %q, then %q", a, again)
+	}
+	if b, _ := l.Upload(ctx, "two"); b == a {
+		t.Errorf("different texts both gave %q", a)
+	}
+	if !l.Resolves(ctx, a) {
+		t.Errorf("%s does not resolve after upload", a)
+	}
+	for _, bad := range []string{"https://other.example/p/x.txt", "https://files.example/p/../x", "https://files.example/p/"} {
+		if l.Resolves(ctx, bad) {
+			t.Errorf("%s resolves", bad)
+		}
+		if err := l.Delete(ctx, bad); err == nil {
+			t.Errorf("Delete(%s) succeeded", bad)
+		}
+	}
+	if err := l.Delete(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if l.Resolves(ctx, a) {
+		t.Errorf("%s still resolves after Delete", a)
+	}
+	if err := l.Delete(ctx, a); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+	if _, err := (&LocalDir{Dir: t.TempDir()}).Upload(ctx, "x"); err == nil {
+		t.Error("Upload without a URL prefix succeeded")
+	}
+}
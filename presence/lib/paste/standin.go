@@ -0,0 +1,113 @@
+package paste
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// StandIn is an in-memory paste service speaking the paste.rs protocol:
+// POST (or PUT) / stores the body and answers with its URL, GET /<id>
+// returns it and DELETE /<id> removes it. It lets the upload and button
+// flow run without network access.
+type StandIn struct {
+	mu     sync.Mutex
+	pastes map[string]string
+	base   string
+	srv    *http.Server
+}
+
+// StartStandIn serves a StandIn on addr ("127.0.0.1:0" picks a free port).
+func StartStandIn(addr string) (*StandIn, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StandIn{
+		pastes: map[string]string{},
+		base:   "http://" + ln.Addr().String(),
+	}
+	s.srv = &http.Server{Handler: s}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+// URL is the base URL to upload to.
+func (s *StandIn) URL() string { return s.base }
+
+// Close stops the server and drops every paste.
+func (s *StandIn) Close() error { return s.srv.Close() }
+
+// Len returns the number of stored pastes.
+func (s *StandIn) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pastes)
+}
+
+func (s *StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case id == "" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		b, err := readUpload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var raw [6]byte
+		rand.Read(raw[:])
+		id = hex.EncodeToString(raw[:])
+		s.mu.Lock()
+		s.pastes[id] = string(b)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, s.base+"/"+id+"\n")
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.mu.Lock()
+		text, ok := s.pastes[id]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, text)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		_, ok := s.pastes[id]
+		delete(s.pastes, id)
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// readUpload returns the uploaded text, taken from the first form file of a
+// multipart request (as 0x0.st expects) or from the raw body otherwise.
+func readUpload(r *http.Request) ([]byte, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			return nil, err
+		}
+		for _, files := range r.MultipartForm.File {
+			f, err := files[0].Open()
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return io.ReadAll(f)
+		}
+		return nil, errors.New("no file in form")
+	}
+	return io.ReadAll(io.LimitReader(r.Body, 1<<20))
+}
@@ -0,0 +1,550 @@
+// Package proxy multiplexes several local IPC clients onto one Discord
+// connection. Discord shows a single activity per connection, so the
+// proxy keeps every client's latest activity and forwards the one its
+// policy picks, or a merge of them.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/presence/lib/ipc"
+)
+
+// upstreamTimeout bounds each exchange with Discord.
+const upstreamTimeout = 10 * time.Second
+
+// Policy decides what reaches Discord when several clients have an activity.
+type Policy string
+
+const (
+	// PolicyPriority shows the activity of the highest priority client,
+	// the most recently updated one on a tie.
+	PolicyPriority Policy = "priority"
+	// PolicyLatest shows the most recently updated activity.
+	PolicyLatest Policy = "latest"
+	// PolicyMerge starts from the PolicyPriority pick and fills the fields
+	// it leaves empty from the clients below it.
+	PolicyMerge Policy = "merge"
+)
+
+// ParsePolicy checks s names a policy; empty means PolicyPriority.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return PolicyPriority, nil
+	case PolicyPriority, PolicyLatest, PolicyMerge:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q (want priority, latest or merge)", s)
+}
+
+// Proxy accepts clients on a listener and forwards to Dial.
+type Proxy struct {
+	// ClientID is the application the upstream connection handshakes
+	// as, which is whose name Discord shows above the activity.
+	ClientID string
+	Policy   Policy
+	// Priorities ranks clients by the client_id of their handshake;
+	// unlisted ones get 0.
+	Priorities map[string]int
+	// Dial opens the upstream socket, ipc.Dial(0) if nil.
+	Dial func() (net.Conn, error)
+	// Logger, if set, receives connection and forwarding events.
+	Logger *slog.Logger
+	// MaxFrameSize bounds the frames read from clients and from Discord,
+	// ipc.DefaultMaxFrameSize if zero.
+	MaxFrameSize int
+
+	mu      sync.Mutex
+	clients map[*conn]struct{}
+	seq     uint64          // orders updates across clients
+	sent    json.RawMessage // activity last forwarded, nil if cleared
+
+	fwd sync.Mutex // serializes forward, so updates reach Discord in order
+
+	upMu  sync.Mutex
+	up    net.Conn
+	ready json.RawMessage // upstream READY data, replayed to clients
+}
+
+// conn is one client connection and the activity it last set.
+type conn struct {
+	net.Conn
+	clientID string
+	priority int
+	activity json.RawMessage
+	seq      uint64
+
+	wmu sync.Mutex
+}
+
+// frame is the envelope of every opcode 1 message: Args on commands,
+// Data and Evt on responses.
+type frame struct {
+	Cmd   string          `json:"cmd"`
+	Args  json.RawMessage `json:"args,omitempty"`
+	Data  any             `json:"data"`
+	Evt   any             `json:"evt"`
+	Nonce string          `json:"nonce,omitempty"`
+}
+
+// command is a frame the proxy sends upstream itself.
+type command struct {
+	Cmd   string          `json:"cmd"`
+	Args  json.RawMessage `json:"args"`
+	Nonce string          `json:"nonce"`
+}
+
+type setActivityArgs struct {
+	Pid      int             `json:"pid"`
+	Activity json.RawMessage `json:"activity"`
+}
+
+// Serve accepts clients until ln is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	if _, err := p.upstream(); err != nil {
+		// not fatal, clients may show up before Discord does
+		p.log().Warn("upstream not connected", "err", err)
+	}
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go p.handle(&conn{Conn: c})
+	}
+}
+
+// Close drops the upstream connection, which also clears the activity.
+func (p *Proxy) Close() error {
+	p.upMu.Lock()
+	defer p.upMu.Unlock()
+	if p.up == nil {
+		return nil
+	}
+	// a stalled Discord must not hold up shutdown
+	p.up.SetWriteDeadline(time.Now().Add(upstreamTimeout))
+	if err := ipc.WriteFrame(p.up, ipc.OpClose, []byte("{}")); err != nil {
+		p.log().Warn("sending close upstream failed", "err", err)
+	}
+	err := p.up.Close()
+	p.up = nil
+	return err
+}
+
+func (p *Proxy) log() *slog.Logger {
+	if p.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return p.Logger
+}
+
+func (p *Proxy) handle(c *conn) {
+	defer c.Close()
+
+	dec := ipc.NewDecoder(c, p.MaxFrameSize)
+	op, payload, err := dec.Decode()
+	if err != nil {
+		p.log().Debug("bad handshake frame", "err", err)
+		c.closeWith(4000, "expected a handshake with a client_id")
+		return
+	}
+	var hs struct {
+		V        int    `json:"v"`
+		ClientID string `json:"client_id"`
+	}
+	if op != ipc.OpHandshake || json.Unmarshal(payload, &hs) != nil || hs.ClientID == "" {
+		c.closeWith(4000, "expected a handshake with a client_id")
+		return
+	}
+	c.clientID = hs.ClientID
+	c.priority = p.Priorities[hs.ClientID]
+	if err := c.write(ipc.OpFrame, frame{Cmd: "DISPATCH", Evt: "READY", Data: p.readyData()}); err != nil {
+		return
+	}
+	p.log().Info("client connected", "client_id", c.clientID)
+
+	p.mu.Lock()
+	if p.clients == nil {
+		p.clients = map[*conn]struct{}{}
+	}
+	p.clients[c] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, c)
+		p.mu.Unlock()
+		p.log().Info("client disconnected", "client_id", c.clientID)
+		p.forward()
+	}()
+
+	for {
+		op, payload, err := dec.Decode()
+		switch {
+		case errors.Is(err, ipc.ErrBadPayload):
+			// the frame was consumed whole, so the client can go on
+			if c.write(ipc.OpFrame, errorFrame("", "", 4000, "payload must be JSON")) != nil {
+				return
+			}
+			continue
+		case errors.Is(err, ipc.ErrFrameTooLarge), errors.Is(err, ipc.ErrBadOpcode):
+			p.log().Warn("dropping client", "client_id", c.clientID, "err", err)
+			c.closeWith(4000, err.Error())
+			return
+		case err != nil:
+			return
+		}
+		switch op {
+		case ipc.OpPing:
+			if c.writeRaw(ipc.OpPong, payload) != nil {
+				return
+			}
+		case ipc.OpClose:
+			return
+		case ipc.OpFrame:
+			if err := p.command(c, payload); err != nil {
+				return
+			}
+		default:
+			c.closeWith(4000, fmt.Sprintf("unexpected opcode %d", op))
+			return
+		}
+	}
+}
+
+// command answers one opcode 1 frame from c.
+func (p *Proxy) command(c *conn, payload []byte) error {
+	var f frame
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return c.write(ipc.OpFrame, errorFrame("", "", 4000, "invalid payload"))
+	}
+	if f.Cmd != "SET_ACTIVITY" {
+		// anything else goes to Discord as is; the client's own nonce
+		// comes back in the response
+		resp, err := p.request(payload)
+		if err != nil {
+			return c.write(ipc.OpFrame, errorFrame(f.Cmd, f.Nonce, 1000, err.Error()))
+		}
+		return c.writeRaw(ipc.OpFrame, resp)
+	}
+
+	var args setActivityArgs
+	if err := json.Unmarshal(f.Args, &args); err != nil {
+		return c.write(ipc.OpFrame, errorFrame(f.Cmd, f.Nonce, 4000, "invalid args"))
+	}
+	if string(args.Activity) == "null" {
+		args.Activity = nil
+	}
+	p.mu.Lock()
+	p.seq++
+	c.activity, c.seq = args.Activity, p.seq
+	p.mu.Unlock()
+
+	from, err := p.forward()
+	if err != nil {
+		p.log().Warn("forward failed", "err", err)
+		// the client whose activity failed hears why; the others keep
+		// theirs until it is their turn
+		if slices.Contains(from, c) {
+			var rej *rejectedError
+			if errors.As(err, &rej) {
+				return c.write(ipc.OpFrame, errorFrame(f.Cmd, f.Nonce, rej.Code, rej.Message))
+			}
+			return c.write(ipc.OpFrame, errorFrame(f.Cmd, f.Nonce, 1000, err.Error()))
+		}
+	}
+	// Discord echoes the activity it accepted; the client gets its own
+	// back whether or not it is the one shown
+	return c.write(ipc.OpFrame, frame{Cmd: f.Cmd, Data: args.Activity, Nonce: f.Nonce})
+}
+
+// rejectedError is the ERROR event Discord answered a forward with.
+type rejectedError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("discord rejected the activity: %d %s", e.Code, e.Message)
+}
+
+// forward sends the activity the policy picks, if it is not the one
+// Discord already has. It returns the clients whose activity went into
+// it, also when sending failed.
+func (p *Proxy) forward() ([]*conn, error) {
+	p.fwd.Lock()
+	defer p.fwd.Unlock()
+	p.mu.Lock()
+	act, from, err := p.pick()
+	if err != nil {
+		p.mu.Unlock()
+		return from, err
+	}
+	if string(act) == string(p.sent) {
+		p.mu.Unlock()
+		return from, nil
+	}
+	p.mu.Unlock()
+
+	args, err := json.Marshal(setActivityArgs{Pid: os.Getpid(), Activity: orNull(act)})
+	if err != nil {
+		return from, err
+	}
+	req, err := json.Marshal(command{Cmd: "SET_ACTIVITY", Args: args, Nonce: nonce()})
+	if err != nil {
+		return from, err
+	}
+	resp, err := p.request(req)
+	if err != nil {
+		return from, err
+	}
+	var f struct {
+		Evt  string        `json:"evt"`
+		Data rejectedError `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &f); err == nil && f.Evt == "ERROR" {
+		return from, &f.Data
+	}
+
+	p.mu.Lock()
+	p.sent = act
+	p.mu.Unlock()
+	return from, nil
+}
+
+// pick returns the activity to show by policy, nil for none, and the
+// clients it comes from. p.mu is held.
+func (p *Proxy) pick() (json.RawMessage, []*conn, error) {
+	var set []*conn
+	for c := range p.clients {
+		if c.activity != nil {
+			set = append(set, c)
+		}
+	}
+	if len(set) == 0 {
+		return nil, nil, nil
+	}
+	sort.Slice(set, func(i, j int) bool {
+		if p.Policy != PolicyLatest && set[i].priority != set[j].priority {
+			return set[i].priority > set[j].priority
+		}
+		return set[i].seq > set[j].seq
+	})
+	if p.Policy != PolicyMerge || len(set) == 1 {
+		return set[0].activity, set[:1], nil
+	}
+
+	acts := make([]json.RawMessage, len(set))
+	for i, c := range set {
+		acts[i] = c.activity
+	}
+	act, err := merge(acts)
+	return act, set, err
+}
+
+// merge fills the fields the first activity leaves out from the ones
+// after it. Assets are merged key by key, everything else whole.
+func merge(acts []json.RawMessage) (json.RawMessage, error) {
+	out := map[string]json.RawMessage{}
+	assets := map[string]json.RawMessage{}
+	for _, a := range acts {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(a, &fields); err != nil {
+			return nil, err
+		}
+		for k, v := range fields {
+			if k == "assets" {
+				var as map[string]json.RawMessage
+				json.Unmarshal(v, &as)
+				for ak, av := range as {
+					if _, ok := assets[ak]; !ok {
+						assets[ak] = av
+					}
+				}
+				continue
+			}
+			if _, ok := out[k]; !ok {
+				out[k] = v
+			}
+		}
+	}
+	if len(assets) > 0 {
+		b, err := json.Marshal(assets)
+		if err != nil {
+			return nil, err
+		}
+		out["assets"] = b
+	}
+	return json.Marshal(out)
+}
+
+// request sends one frame upstream and returns the response carrying the
+// same nonce, reconnecting once if the connection broke.
+func (p *Proxy) request(payload []byte) ([]byte, error) {
+	var f frame
+	json.Unmarshal(payload, &f)
+
+	p.upMu.Lock()
+	defer p.upMu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var resp []byte
+		if resp, err = p.roundTrip(payload, f.Nonce); err == nil {
+			return resp, nil
+		}
+		if p.up != nil {
+			p.up.Close()
+			p.up = nil
+		}
+	}
+	return nil, err
+}
+
+// roundTrip is request without the retry; p.upMu is held.
+func (p *Proxy) roundTrip(payload []byte, nonce string) ([]byte, error) {
+	if p.up == nil {
+		if err := p.connect(); err != nil {
+			return nil, err
+		}
+	}
+	// a hung Discord must not hold every client up forever
+	p.up.SetDeadline(time.Now().Add(upstreamTimeout))
+	defer func() {
+		if p.up != nil {
+			p.up.SetDeadline(time.Time{})
+		}
+	}()
+	if err := ipc.WriteFrame(p.up, ipc.OpFrame, payload); err != nil {
+		return nil, err
+	}
+	dec := ipc.NewDecoder(p.up, p.MaxFrameSize)
+	for {
+		op, resp, err := dec.Decode()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ipc.OpPing:
+			ipc.WriteFrame(p.up, ipc.OpPong, resp)
+			continue
+		case ipc.OpClose:
+			return nil, fmt.Errorf("discord closed the connection: %s", resp)
+		}
+		var f frame
+		if json.Unmarshal(resp, &f) == nil && f.Nonce == nonce {
+			return resp, nil
+		}
+		// events nobody asked for are dropped
+	}
+}
+
+// upstream connects if not connected yet and returns the READY data.
+func (p *Proxy) upstream() (json.RawMessage, error) {
+	p.upMu.Lock()
+	defer p.upMu.Unlock()
+	if p.up == nil {
+		if err := p.connect(); err != nil {
+			return nil, err
+		}
+	}
+	return p.ready, nil
+}
+
+// connect dials and handshakes upstream; p.upMu is held.
+func (p *Proxy) connect() error {
+	dial := p.Dial
+	if dial == nil {
+		dial = func() (net.Conn, error) { return ipc.Dial(context.Background(), 0) }
+	}
+	up, err := dial()
+	if err != nil {
+		return err
+	}
+	up.SetDeadline(time.Now().Add(upstreamTimeout))
+	defer up.SetDeadline(time.Time{})
+	hs, _ := json.Marshal(map[string]any{"v": 1, "client_id": p.ClientID})
+	if err := ipc.WriteFrame(up, ipc.OpHandshake, hs); err != nil {
+		up.Close()
+		return err
+	}
+	op, resp, err := ipc.NewDecoder(up, p.MaxFrameSize).Decode()
+	if err != nil {
+		up.Close()
+		return err
+	}
+	var ready struct {
+		Evt  string          `json:"evt"`
+		Data json.RawMessage `json:"data"`
+	}
+	if op != ipc.OpFrame || json.Unmarshal(resp, &ready) != nil || ready.Evt != "READY" {
+		up.Close()
+		return fmt.Errorf("handshake rejected: %s", resp)
+	}
+	p.up, p.ready = up, ready.Data
+	p.log().Info("connected upstream", "client_id", p.ClientID)
+
+	// a fresh connection has no activity; resend on the next forward
+	p.mu.Lock()
+	p.sent = nil
+	p.mu.Unlock()
+	return nil
+}
+
+// readyData is what clients get in their READY: Discord's own if the
+// proxy is connected, a minimal stand-in otherwise.
+func (p *Proxy) readyData() any {
+	if ready, err := p.upstream(); err == nil && ready != nil {
+		return ready
+	}
+	return map[string]any{"v": 1, "config": map[string]any{}}
+}
+
+func (c *conn) write(opcode int, f frame) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return c.writeRaw(opcode, b)
+}
+
+func (c *conn) writeRaw(opcode int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return ipc.WriteFrame(c, opcode, payload)
+}
+
+// closeWith sends a CLOSE frame the way Discord does on protocol errors.
+func (c *conn) closeWith(code int, message string) {
+	b, _ := json.Marshal(map[string]any{"code": code, "message": message})
+	c.writeRaw(ipc.OpClose, b)
+}
+
+func errorFrame(cmd, nonce string, code int, message string) frame {
+	return frame{Cmd: cmd, Evt: "ERROR", Nonce: nonce, Data: map[string]any{"code": code, "message": message}}
+}
+
+// orNull keeps a cleared activity as an explicit JSON null.
+func orNull(act json.RawMessage) json.RawMessage {
+	if act == nil {
+		return json.RawMessage("null")
+	}
+	return act
+}
+
+// nonce returns a unique nonce for frames the proxy sends itself.
+func nonce() string {
+	return fmt.Sprintf("proxy-%d-%d", os.Getpid(), time.Now().UnixNano())
+}
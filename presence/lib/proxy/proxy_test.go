@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/presence/lib/fakediscord"
+	"example.com/presence/lib/ipc"
+)
+
+const (
+	appID  = "100000000000000001"
+	highID = "100000000000000002"
+	lowID  = "100000000000000003"
+)
+
+// newProxy returns a proxy whose upstream is srv.
+func newProxy(t *testing.T, srv *fakediscord.Server, policy Policy) *Proxy {
+	p := &Proxy{
+		ClientID:   appID,
+		Policy:     policy,
+		Priorities: map[string]int{highID: 1},
+		Dial: func() (net.Conn, error) {
+			a, b := net.Pipe()
+			go srv.ServeConn(b)
+			return a, nil
+		},
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+type testClient struct {
+	net.Conn
+	dec   *ipc.Decoder
+	nonce int
+}
+
+// connect hands one end of a pipe to p and handshakes on the other.
+func connect(t *testing.T, p *Proxy, clientID string) *testClient {
+	t.Helper()
+	local, remote := net.Pipe()
+	go p.handle(&conn{Conn: remote})
+	c := &testClient{Conn: local, dec: ipc.NewDecoder(local, 0)}
+	t.Cleanup(func() { c.Close() })
+	local.SetDeadline(time.Now().Add(5 * time.Second))
+
+	hs, _ := json.Marshal(map[string]any{"v": 1, "client_id": clientID})
+	if err := ipc.WriteFrame(c, ipc.OpHandshake, hs); err != nil {
+		t.Fatal(err)
+	}
+	if f := c.read(t); f.Evt != "READY" {
+		t.Fatalf("handshake answered with %+v", f)
+	}
+	return c
+}
+
+type response struct {
+	Evt  string          `json:"evt"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (c *testClient) read(t *testing.T) response {
+	t.Helper()
+	op, payload, err := c.dec.Decode()
+	if err != nil || op != ipc.OpFrame {
+		t.Fatalf("read = %d %s %v", op, payload, err)
+	}
+	var r response
+	if err := json.Unmarshal(payload, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// set sends SET_ACTIVITY and returns the answer.
+func (c *testClient) set(t *testing.T, activity string) response {
+	t.Helper()
+	c.nonce++
+	req, _ := json.Marshal(map[string]any{
+		"cmd":   "SET_ACTIVITY",
+		"args":  map[string]any{"pid": 1, "activity": json.RawMessage(activity)},
+		"nonce": strings.Repeat("n", c.nonce),
+	})
+	if err := ipc.WriteFrame(c, ipc.OpFrame, req); err != nil {
+		t.Fatal(err)
+	}
+	return c.read(t)
+}
+
+// shows waits for srv to hold want, an activity or "null".
+func shows(t *testing.T, srv *fakediscord.Server, want string) {
+	t.Helper()
+	var got json.RawMessage
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got = srv.Activity(); sameJSON(orNull(got), json.RawMessage(want)) {
+			return
+		}
+	}
+	t.Errorf("discord shows %s, want %s", orNull(got), want)
+}
+
+func sameJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestPolicies(t *testing.T) {
+	const (
+		high = `{"details":"from high","assets":{"large_image":"high"}}`
+		low  = `{"details":"from low","state":"low state","assets":{"large_image":"low","small_image":"dot"}}`
+	)
+	tests := []struct {
+		policy Policy
+		want   string
+	}{
+		{PolicyPriority, high},
+		{PolicyLatest, low},
+		{PolicyMerge, `{"details":"from high","state":"low state","assets":{"large_image":"high","small_image":"dot"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			srv := &fakediscord.Server{}
+			p := newProxy(t, srv, tt.policy)
+			a, b := connect(t, p, highID), connect(t, p, lowID)
+			if r := a.set(t, high); r.Evt != "" {
+				t.Fatalf("high client got %+v", r)
+			}
+			if r := b.set(t, low); r.Evt != "" || !sameJSON(r.Data, json.RawMessage(low)) {
+				t.Fatalf("low client got %+v, want its own activity back", r)
+			}
+			shows(t, srv, tt.want)
+		})
+	}
+}
+
+func TestPriorityTieGoesToLatest(t *testing.T) {
+	srv := &fakediscord.Server{}
+	p := newProxy(t, srv, PolicyPriority)
+	a, b := connect(t, p, lowID), connect(t, p, lowID)
+	a.set(t, `{"details":"first"}`)
+	b.set(t, `{"details":"second"}`)
+	shows(t, srv, `{"details":"second"}`)
+	a.set(t, `{"details":"third"}`)
+	shows(t, srv, `{"details":"third"}`)
+}
+
+func TestClientDisconnect(t *testing.T) {
+	srv := &fakediscord.Server{}
+	p := newProxy(t, srv, PolicyPriority)
+	a, b := connect(t, p, highID), connect(t, p, lowID)
+	a.set(t, `{"details":"from high"}`)
+	b.set(t, `{"details":"from low"}`)
+	shows(t, srv, `{"details":"from high"}`)
+
+	a.Close()
+	shows(t, srv, `{"details":"from low"}`)
+	b.Close()
+	shows(t, srv, "null")
+}
+
+func TestRejectedActivity(t *testing.T) {
+	srv := &fakediscord.Server{}
+	p := newProxy(t, srv, PolicyPriority)
+	a := connect(t, p, highID)
+	a.set(t, `{"details":"fine"}`)
+
+	r := a.set(t, `{"details":"x"}`)
+	var data struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(r.Data, &data)
+	if r.Evt != "ERROR" || data.Code != fakediscord.ErrInvalidPayload || !strings.Contains(data.Message, `"details"`) {
+		t.Errorf("rejected activity answered with %s %s, want Discord's error", r.Evt, r.Data)
+	}
+	shows(t, srv, `{"details":"fine"}`)
+}
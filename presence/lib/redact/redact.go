@@ -0,0 +1,156 @@
+package redact
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Rule replaces every match of Pattern with Replace, which may refer to
+// submatches as in regexp.Expand ("${1}"). When Keep is set, a match is
+// only replaced if Keep returns false for it.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Replace string
+	Keep    func(match string) bool
+}
+
+// Redactor applies a list of rules in order.
+type Redactor struct {
+	rules []Rule
+}
+
+// Builtins lists the names accepted by New. It is for callers to offer or
+// enable; changing it does not change the rules New knows.
+var Builtins = slices.Clone(builtinOrder)
+
+// builtinOrder is the order the built-in rules are applied in.
+// Home-directory paths go before usernames so "/home/alice" turns into
+// "~" rather than "/home/<user>".
+var builtinOrder = []string{"home", "hostname", "username", "ip", "mac", "serial"}
+
+// New returns a Redactor running the named built-in rules followed by extra.
+func New(builtins []string, extra []Rule) (*Redactor, error) {
+	enabled := map[string]bool{}
+	for _, name := range builtins {
+		if !isBuiltin(name) {
+			return nil, fmt.Errorf("redact: unknown built-in rule %q (have %s)", name, strings.Join(builtinOrder, ", "))
+		}
+		enabled[name] = true
+	}
+	r := &Redactor{}
+	for _, name := range builtinOrder {
+		if enabled[name] {
+			r.rules = append(r.rules, builtinRules(name)...)
+		}
+	}
+	r.rules = append(r.rules, extra...)
+	return r, nil
+}
+
+func isBuiltin(name string) bool {
+	return slices.Contains(builtinOrder, name)
+}
+
+// String redacts s. A nil Redactor returns s unchanged.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.rules {
+		rule := rule
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(m string) string {
+			if rule.Keep != nil && rule.Keep(m) {
+				return m
+			}
+			// expand the replacement against this match's own submatches
+			sub := rule.Pattern.FindStringSubmatchIndex(m)
+			if sub == nil {
+				return rule.Replace
+			}
+			return string(rule.Pattern.ExpandString(nil, rule.Replace, m, sub))
+		})
+	}
+	return s
+}
+
+// literal matches any of words as a whole word, longest first.
+func literal(words ...string) *regexp.Regexp {
+	var quoted []string
+	for _, w := range words {
+		if w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return regexp.MustCompile(`\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// The IP patterns take in what makes a match not an address, so its Keep
+// can see it: a "v" or "version" before a dotted quad, further dotted
+// numbers as in 1.2.3.4.5, or the letters around a "::" as in
+// std::vector.
+var (
+	ipv4Re   = regexp.MustCompile(`(?i)(?:\bv(?:ersion)?[\s:]*|\b)(?:\d+\.){3,}\d+\b`)
+	ipv6Re   = regexp.MustCompile(`(?i)\w*(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}\w*(?:%[0-9a-z]+)?`)
+	macRe    = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{2}[:-]){5}[0-9a-f]{2}\b`)
+	serialRe = regexp.MustCompile(`(?i)\b((?:serial(?:[ _-]?(?:number|no\.?))?|s/n)\s*[:=#]?\s*)([A-Za-z0-9-]{4,})`)
+	homeRe   = regexp.MustCompile(`(?:/home|/Users)/[^/\s:]+`)
+)
+
+func builtinRules(name string) []Rule {
+	switch name {
+	case "home":
+		var rules []Rule
+		if home, err := os.UserHomeDir(); err == nil && home != "/" {
+			// only where a path starts, so a home of /root leaves /home/root
+			// to homeRe rather than turning it into /home~
+			rules = append(rules, Rule{Name: name, Pattern: regexp.MustCompile(`(^|[^\w./-])` + regexp.QuoteMeta(home) + `\b`), Replace: "${1}~"})
+		}
+		return append(rules, Rule{Name: name, Pattern: homeRe, Replace: "~"})
+	case "hostname":
+		host, err := os.Hostname()
+		if err != nil {
+			return nil
+		}
+		short, _, _ := strings.Cut(host, ".")
+		if re := literal(host, short); re != nil {
+			return []Rule{{Name: name, Pattern: re, Replace: "<host>"}}
+		}
+	case "username":
+		u, err := user.Current()
+		if err != nil {
+			return nil
+		}
+		if re := literal(u.Username); re != nil {
+			return []Rule{{Name: name, Pattern: re, Replace: "<user>"}}
+		}
+	case "ip":
+		notIP := func(m string) bool { return net.ParseIP(strings.SplitN(m, "%", 2)[0]) == nil }
+		return []Rule{
+			// MACs look like IPv6 to the pattern; ParseIP tells them apart,
+			// as it does for clock times such as 12:30:00
+			{Name: name, Pattern: ipv4Re, Replace: "<ip>", Keep: func(m string) bool {
+				return m[0] < '0' || m[0] > '9' || notIP(m)
+			}},
+			{Name: name, Pattern: ipv6Re, Replace: "<ip>", Keep: notIP},
+		}
+	case "mac":
+		return []Rule{{Name: name, Pattern: macRe, Replace: "<mac>"}}
+	case "serial":
+		// a value without a digit is a word, as in "serial port"
+		return []Rule{{Name: name, Pattern: serialRe, Replace: "${1}<serial>", Keep: func(m string) bool {
+			return !strings.ContainsAny(serialRe.FindStringSubmatch(m)[2], "0123456789")
+		}}}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	host, _ := os.Hostname()
+	short, _, _ := strings.Cut(host, ".")
+	u, err := user.Current()
+	if err != nil {
+		u = &user.User{}
+	}
+
+	tests := []struct {
+		rules    []string
+		in, want string
+		skip     bool
+	}{
+		{[]string{"home"}, "config in " + home + "/.config/fastfetch", "config in ~/.config/fastfetch", home == "" || home == "/"},
+		{[]string{"home"}, "/home/alice/bin and /Users/bob", "~/bin and ~", false},
+		{[]string{"home"}, "/homework/x", "/homework/x", false},
+		{[]string{"home"}, "/srv" + home + "/x", "/srv" + home + "/x", home == "" || home == "/"},
+
+		{[]string{"hostname"}, "up on " + host + " since boot", "up on <host> since boot", host == ""},
+		{[]string{"hostname"}, short + ".lan, " + short, "<host>.lan, <host>", short == ""},
+		{[]string{"hostname"}, "x" + short + "x", "x" + short + "x", short == ""},
+
+		{[]string{"username"}, "logged in as " + u.Username, "logged in as <user>", u.Username == ""},
+		{[]string{"username"}, u.Username + "fs", u.Username + "fs", u.Username == ""},
+		{[]string{"home", "username"}, "/home/" + u.Username + "/src", "~/src", u.Username == ""},
+
+		{[]string{"ip"}, "inet 192.168.1.20/24 brd 192.168.1.255", "inet <ip>/24 brd <ip>", false},
+		{[]string{"ip"}, "gateway 10.0.0.1.", "gateway <ip>.", false},
+		{[]string{"ip"}, "inet6 fe80::1%eth0 and 2001:db8::8a2e:370:7334", "inet6 <ip> and <ip>", false},
+		{[]string{"ip"}, "dns ::1", "dns <ip>", false},
+		{[]string{"ip"}, "uptime 12:30:00", "uptime 12:30:00", false},
+		{[]string{"ip"}, "Mesa v1.2.3.4", "Mesa v1.2.3.4", false},
+		{[]string{"ip"}, "Version: 10.0.0.1", "Version: 10.0.0.1", false},
+		{[]string{"ip"}, "firmware 1.2.3.4.5", "firmware 1.2.3.4.5", false},
+		{[]string{"ip"}, "Windows 10.0.19045.4529", "Windows 10.0.19045.4529", false},
+		{[]string{"ip"}, "build 300.1.1.1", "build 300.1.1.1", false},
+		{[]string{"ip"}, "std::vector<int>", "std::vector<int>", false},
+		{[]string{"ip"}, "wlan0 aa:bb:cc:dd:ee:ff", "wlan0 aa:bb:cc:dd:ee:ff", false},
+
+		{[]string{"mac"}, "ether aa:bb:cc:dd:ee:ff and 00-1A-2B-3C-4D-5E", "ether <mac> and <mac>", false},
+		{[]string{"ip", "mac"}, "link/ether aa:bb:cc:dd:ee:0f", "link/ether <mac>", false},
+		{[]string{"mac"}, "at 12:30:00", "at 12:30:00", false},
+
+		{[]string{"serial"}, "Serial Number: ABC123XYZ", "Serial Number: <serial>", false},
+		{[]string{"serial"}, "S/N XY-1234, serial_no=77889", "S/N <serial>, serial_no=<serial>", false},
+		{[]string{"serial"}, "serial port ttyS0", "serial port ttyS0", false},
+		{[]string{"serial"}, "Serial Number: To Be Filled By O.E.M.", "Serial Number: To Be Filled By O.E.M.", false},
+		{[]string{"serial"}, "serialize", "serialize", false},
+	}
+	for _, tt := range tests {
+		if tt.skip {
+			t.Logf("%v %q: skipped, nothing to redact here", tt.rules, tt.in)
+			continue
+		}
+		r, err := New(tt.rules, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("%v: String(%q) = %q, want %q", tt.rules, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHomeOutsideHome(t *testing.T) {
+	t.Setenv("HOME", "/data/alice")
+	r, err := New([]string{"home"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "/data/alice/.cache, cd /data/alice and /mnt/data/alice or /data/alice2"
+	want := "~/.cache, cd ~ and /mnt/data/alice or /data/alice2"
+	if got := r.String(in); got != want {
+		t.Errorf("String(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestExtraRules(t *testing.T) {
+	r, err := New([]string{"ip"}, []Rule{
+		{Name: "token", Pattern: regexp.MustCompile(`token=(\w+)`), Replace: "token=<${1}>"},
+		{Name: "keep", Pattern: regexp.MustCompile(`secret-\w+`), Replace: "<secret>", Keep: func(m string) bool { return m == "secret-ok" }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "10.1.2.3 token=abc secret-ok secret-x"
+	want := "<ip> token=<abc> secret-ok <secret>"
+	if got := r.String(in); got != want {
+		t.Errorf("String(%q) = %q, want %q", in, got, want)
+	}
+
+	if _, err := New([]string{"email"}, nil); err == nil {
+		t.Error("New accepted an unknown built-in rule")
+	}
+	var none *Redactor
+	if got := none.String(in); got != in {
+		t.Errorf("nil Redactor changed %q to %q", in, got)
+	}
+}
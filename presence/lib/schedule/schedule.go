@@ -0,0 +1,157 @@
+// Package schedule matches wall-clock time ranges on chosen weekdays,
+// such as weekdays 09:00-18:00, and finds the next time that changes.
+//
+// Times are read on the wall clock of the schedule's location, so a range
+// keeps its hours across daylight saving changes. A start that falls into
+// the hour skipped in spring moves forward by that hour, as time.Date does.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Days is a set of weekdays, bit i standing for time.Weekday(i).
+type Days uint8
+
+// AllDays holds every weekday.
+const AllDays Days = 1<<7 - 1
+
+// Has reports whether d holds wd.
+func (d Days) Has(wd time.Weekday) bool { return d&(1<<wd) != 0 }
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseDays reads a day mask: comma separated days ("sat,sun") and ranges
+// ("mon-fri", "fri-mon"), or one of "daily", "weekdays" and "weekends".
+// Empty means daily.
+func ParseDays(s string) (Days, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "daily":
+		return AllDays, nil
+	case "weekdays":
+		return ParseDays("mon-fri")
+	case "weekends":
+		return ParseDays("sat,sun")
+	}
+	var d Days
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return 0, fmt.Errorf("unknown day %q (want mon, tue, ...)", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return 0, fmt.Errorf("unknown day %q (want mon, tue, ...)", to)
+			}
+		}
+		for wd := first; ; wd = (wd + 1) % 7 {
+			d |= 1 << wd
+			if wd == last {
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// Clock is a time of day in minutes after midnight.
+type Clock int
+
+// ParseClock reads "HH:MM" on a 24-hour clock; "24:00" is the end of
+// the day.
+func ParseClock(s string) (Clock, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh > 24 || hh == 24 && mm != 0 {
+		return 0, fmt.Errorf("bad time of day %q (want HH:MM)", s)
+	}
+	return Clock(hh*60 + mm), nil
+}
+
+// on returns the clock time on the given day in loc.
+func (c Clock) on(y int, m time.Month, d int, loc *time.Location) time.Time {
+	return time.Date(y, m, d, int(c)/60, int(c)%60, 0, 0, loc)
+}
+
+// Range is a time range on the days in Days. One that ends at or before
+// its start runs overnight, into the next day; From equal to To covers
+// the whole day. Days are those the range starts on.
+type Range struct {
+	Days     Days
+	From, To Clock
+}
+
+// span returns the occurrence of r that starts on the given day.
+func (r Range) span(y int, m time.Month, d int, loc *time.Location) (from, to time.Time) {
+	from = r.From.on(y, m, d, loc)
+	if r.To > r.From {
+		return from, r.To.on(y, m, d, loc)
+	}
+	return from, r.To.on(y, m, d+1, loc)
+}
+
+// Schedule is a list of ranges read in loc; earlier ones win where they
+// overlap.
+type Schedule struct {
+	Ranges []Range
+	Loc    *time.Location
+}
+
+func (s *Schedule) loc() *time.Location {
+	if s.Loc == nil {
+		return time.Local
+	}
+	return s.Loc
+}
+
+// At returns the index of the first range that holds t, or -1.
+func (s *Schedule) At(t time.Time) int {
+	t = t.In(s.loc())
+	y, m, d := t.Date()
+	for i, r := range s.Ranges {
+		// an overnight range may have started yesterday
+		for _, back := range []int{0, 1} {
+			start := time.Date(y, m, d-back, 12, 0, 0, 0, s.loc())
+			if !r.Days.Has(start.Weekday()) {
+				continue
+			}
+			from, to := r.span(y, m, d-back, s.loc())
+			if !t.Before(from) && t.Before(to) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Next returns the first time after t at which some range starts or
+// ends, which is when At may change; the zero time if none ever does.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc())
+	y, m, d := t.Date()
+	var next time.Time
+	for _, r := range s.Ranges {
+		// a week ahead covers every day mask
+		for day := -1; day <= 7; day++ {
+			if !r.Days.Has(time.Date(y, m, d+day, 12, 0, 0, 0, s.loc()).Weekday()) {
+				continue
+			}
+			from, to := r.span(y, m, d+day, s.loc())
+			for _, b := range []time.Time{from, to} {
+				if b.After(t) && (next.IsZero() || b.Before(next)) {
+					next = b
+				}
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,231 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []time.Weekday
+	}{
+		{"", []time.Weekday{0, 1, 2, 3, 4, 5, 6}},
+		{"Daily", []time.Weekday{0, 1, 2, 3, 4, 5, 6}},
+		{"weekdays", []time.Weekday{1, 2, 3, 4, 5}},
+		{"weekends", []time.Weekday{0, 6}},
+		{"mon, wed", []time.Weekday{1, 3}},
+		{"fri-mon", []time.Weekday{0, 1, 5, 6}},
+		{"tue-tue", []time.Weekday{2}},
+	}
+	for _, tt := range tests {
+		var want Days
+		for _, wd := range tt.want {
+			want |= 1 << wd
+		}
+		if got, err := ParseDays(tt.in); err != nil || got != want {
+			t.Errorf("ParseDays(%q) = %07b, %v; want %07b", tt.in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"monday", "mon-", "mon,,tue", "xyz-fri"} {
+		if _, err := ParseDays(bad); err == nil {
+			t.Errorf("ParseDays(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Clock
+	}{
+		{"00:00", 0},
+		{"09:30", 9*60 + 30},
+		{"9:05", 9*60 + 5},
+		{"23:59", 23*60 + 59},
+		{"24:00", 24 * 60},
+	}
+	for _, tt := range tests {
+		if got, err := ParseClock(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "9", "12:60", "24:01", "25:00", "-1:00", "aa:bb"} {
+		if _, err := ParseClock(bad); err == nil {
+			t.Errorf("ParseClock(%q) succeeded", bad)
+		}
+	}
+}
+
+func mustRange(t *testing.T, days, from, to string) Range {
+	t.Helper()
+	d, err := ParseDays(days)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseClock(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ParseClock(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Range{Days: d, From: f, To: e}
+}
+
+func utc(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+}
+
+// 2026-10-19 is a Monday.
+func TestAt(t *testing.T) {
+	s := &Schedule{Loc: time.UTC, Ranges: []Range{
+		mustRange(t, "weekdays", "09:00", "18:00"),
+		mustRange(t, "fri", "22:00", "06:00"), // overnight into Saturday
+		mustRange(t, "sun", "12:00", "12:00"), // a whole day, into Monday
+		mustRange(t, "daily", "08:00", "20:00"),
+	}}
+	tests := []struct {
+		name string
+		t    time.Time
+		want int
+	}{
+		{"before all", utc(10, 20, 7, 59), -1},
+		{"daily range", utc(10, 20, 8, 0), 3},
+		{"whole day from sunday", utc(10, 19, 8, 0), 2},
+		{"first wins", utc(10, 19, 9, 0), 0},
+		{"end is exclusive", utc(10, 19, 18, 0), 3},
+		{"after all", utc(10, 19, 20, 0), -1},
+		{"overnight start", utc(10, 23, 22, 0), 1},
+		{"overnight next morning", utc(10, 24, 5, 59), 1},
+		{"overnight end", utc(10, 24, 6, 0), -1},
+		{"overnight only from its day", utc(10, 24, 23, 0), -1},
+		{"whole day not yet", utc(10, 25, 7, 0), -1},
+		{"whole day start", utc(10, 25, 12, 0), 2},
+		{"whole day next morning", utc(10, 26, 7, 0), 2},
+		{"whole day end", utc(10, 26, 12, 0), 0},
+		{"other location", time.Date(2026, 10, 20, 13, 0, 0, 0, time.FixedZone("UTC+5", 5*3600)), 3},
+	}
+	for _, tt := range tests {
+		if got := s.At(tt.t); got != tt.want {
+			t.Errorf("%s: At(%v) = %d, want %d", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	s := &Schedule{Loc: time.UTC, Ranges: []Range{
+		mustRange(t, "weekdays", "09:00", "18:00"),
+		mustRange(t, "fri", "22:00", "06:00"),
+		mustRange(t, "sun", "12:00", "12:00"),
+	}}
+	tests := []struct {
+		t, want time.Time
+	}{
+		{utc(10, 19, 7, 0), utc(10, 19, 9, 0)},
+		{utc(10, 19, 9, 0), utc(10, 19, 12, 0)},
+		{utc(10, 19, 12, 0), utc(10, 19, 18, 0)},
+		{utc(10, 19, 18, 0), utc(10, 20, 9, 0)},
+		{utc(10, 23, 18, 0), utc(10, 23, 22, 0)},
+		{utc(10, 24, 1, 0), utc(10, 24, 6, 0)},
+		{utc(10, 24, 6, 0), utc(10, 25, 12, 0)},
+		{utc(10, 25, 12, 0), utc(10, 26, 9, 0)},
+		{utc(10, 26, 9, 0), utc(10, 26, 12, 0)},
+	}
+	for _, tt := range tests {
+		if got := s.Next(tt.t); !got.Equal(tt.want) {
+			t.Errorf("Next(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+	if got := (&Schedule{}).Next(utc(10, 19, 0, 0)); !got.IsZero() {
+		t.Errorf("Next of an empty schedule = %v, want zero", got)
+	}
+}
+
+// In Europe/Berlin, 2026-03-29 02:00 CET jumps to 03:00 CEST, and
+// 2026-10-25 03:00 CEST falls back to 02:00 CET. Times below are UTC.
+func TestDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name  string
+		r     Range
+		at    map[time.Time]int
+		after time.Time
+		next  time.Time
+	}{{
+		// 01:00 CET to 04:00 CEST is two hours
+		name: "spring, across the gap",
+		r:    mustRange(t, "sun", "01:00", "04:00"),
+		at: map[time.Time]int{
+			utc(3, 28, 23, 59): -1,
+			utc(3, 29, 0, 0):   0,
+			utc(3, 29, 1, 59):  0,
+			utc(3, 29, 2, 0):   -1,
+		},
+		after: utc(3, 29, 0, 30), next: utc(3, 29, 2, 0),
+	}, {
+		// 02:30 does not exist that day and starts an hour later
+		name: "spring, start in the gap",
+		r:    mustRange(t, "sun", "02:30", "05:00"),
+		at: map[time.Time]int{
+			utc(3, 29, 1, 0):  -1,
+			utc(3, 29, 1, 29): -1,
+			utc(3, 29, 1, 30): 0,
+			utc(3, 29, 2, 59): 0,
+			utc(3, 29, 3, 0):  -1,
+		},
+		after: utc(3, 29, 0, 0), next: utc(3, 29, 1, 30),
+	}, {
+		// 09:00 stays 09:00 on the wall clock, an hour later in UTC
+		name: "autumn, daytime",
+		r:    mustRange(t, "daily", "09:00", "18:00"),
+		at: map[time.Time]int{
+			utc(10, 24, 7, 0):   0,
+			utc(10, 24, 16, 0):  -1,
+			utc(10, 25, 7, 59):  -1,
+			utc(10, 25, 8, 0):   0,
+			utc(10, 25, 16, 59): 0,
+			utc(10, 25, 17, 0):  -1,
+		},
+		after: utc(10, 24, 18, 0), next: utc(10, 25, 8, 0),
+	}, {
+		// 22:00 CEST to 06:00 CET is nine hours
+		name: "autumn, overnight",
+		r:    mustRange(t, "sat", "22:00", "06:00"),
+		at: map[time.Time]int{
+			utc(10, 24, 19, 59): -1,
+			utc(10, 24, 20, 0):  0,
+			utc(10, 25, 4, 59):  0,
+			utc(10, 25, 5, 0):   -1,
+		},
+		after: utc(10, 24, 21, 0), next: utc(10, 25, 5, 0),
+	}, {
+		// 08:00 CEST to 08:00 CET is 25 hours
+		name: "autumn, whole day",
+		r:    mustRange(t, "sat", "08:00", "08:00"),
+		at: map[time.Time]int{
+			utc(10, 24, 5, 59): -1,
+			utc(10, 24, 6, 0):  0,
+			utc(10, 25, 6, 59): 0,
+			utc(10, 25, 7, 0):  -1,
+		},
+		after: utc(10, 24, 6, 0), next: utc(10, 25, 7, 0),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schedule{Loc: berlin, Ranges: []Range{tt.r}}
+			for at, want := range tt.at {
+				if got := s.At(at); got != want {
+					t.Errorf("At(%v) = %d, want %d", at, got, want)
+				}
+			}
+			if got := s.Next(tt.after); !got.Equal(tt.next) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got.UTC(), tt.next)
+			}
+		})
+	}
+}
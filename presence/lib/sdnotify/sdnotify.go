@@ -0,0 +1,81 @@
+// Package sdnotify speaks systemd's sd_notify protocol: newline separated
+// VAR=value assignments sent as one datagram to $NOTIFY_SOCKET.
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// States understood by systemd.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notifier sends state changes to the service manager. A nil *Notifier
+// is valid and sends nothing, so callers need not care whether they run
+// under systemd.
+type Notifier struct {
+	conn *net.UnixConn
+}
+
+// New returns a Notifier for $NOTIFY_SOCKET, or nil if it is not set.
+func New() (*Notifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	return Dial(path)
+}
+
+// Dial returns a Notifier for the datagram socket at path. A leading "@"
+// names a socket in the abstract namespace.
+func Dial(path string) (*Notifier, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{conn: conn}, nil
+}
+
+// Notify sends the given assignments in one datagram.
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// Status sets the free-form status line systemctl status shows.
+func (n *Notifier) Status(s string) error {
+	// a newline would start a new assignment
+	return n.Notify("STATUS=" + strings.ReplaceAll(s, "\n", " "))
+}
+
+// Close closes the socket.
+func (n *Notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+// WatchdogInterval returns how often to send Watchdog: half the timeout
+// in $WATCHDOG_USEC, as systemd recommends. ok is false if the watchdog
+// is off or meant for another process.
+func WatchdogInterval() (d time.Duration, ok bool) {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
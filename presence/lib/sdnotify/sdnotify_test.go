@@ -0,0 +1,123 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listen returns a datagram socket standing in for systemd's.
+func listen(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn, path := listen(t)
+	n, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	tests := []struct {
+		name string
+		send func() error
+		want string
+	}{
+		{"ready", func() error { return n.Notify(Ready) }, "READY=1"},
+		{"several", func() error { return n.Notify(Ready, "STATUS=up") }, "READY=1\nSTATUS=up"},
+		{"status", func() error { return n.Status("a\nb") }, "STATUS=a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatal(err)
+			}
+			if got := receive(t, conn); got != tt.want {
+				t.Errorf("got datagram %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	if err := n.Notify(Ready); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+	if err := n.Status("x"); err != nil {
+		t.Errorf("Status: %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if n, err := New(); n != nil || err != nil {
+		t.Errorf("New() without NOTIFY_SOCKET = %v, %v; want nil, nil", n, err)
+	}
+
+	conn, path := listen(t)
+	t.Setenv("NOTIFY_SOCKET", path)
+	n, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	n.Notify(Stopping)
+	if got := receive(t, conn); got != Stopping {
+		t.Errorf("got datagram %q, want %q", got, Stopping)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name   string
+		pid    string
+		usec   string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"off", "", "", 0, false},
+		{"no pid", "", "20000000", 10 * time.Second, true},
+		{"this process", self, "20000000", 10 * time.Second, true},
+		{"other process", "1", "20000000", 0, false},
+		{"zero", "", "0", 0, false},
+		{"negative", "", "-5", 0, false},
+		{"garbage", "", "20s", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			got, ok := WatchdogInterval()
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("WatchdogInterval() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
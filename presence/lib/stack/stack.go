@@ -0,0 +1,91 @@
+package stack
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/presence/lib/client"
+)
+
+// Layer is one source's idea of what the presence should be.
+type Layer struct {
+	// Source identifies who pushed the layer; pushing again from the same
+	// source replaces it.
+	Source   string `json:"source"`
+	Priority int    `json:"priority"`
+	// Activity is what to show. A nil Activity is a request to show
+	// nothing at all, which hides every layer below it.
+	Activity *client.Activity `json:"activity"`
+	// Expires is when the layer drops out on its own; zero means never.
+	Expires time.Time `json:"expires,omitempty"`
+	Pushed  time.Time `json:"pushed"`
+}
+
+func (l *Layer) live(now time.Time) bool {
+	return l.Expires.IsZero() || now.Before(l.Expires)
+}
+
+// Stack holds the layers of every source and picks the one to show: the
+// highest priority live layer, the most recently pushed one on a tie.
+// Expired layers are dropped lazily, so the next one down shows through
+// as soon as anyone looks. It is safe for concurrent use.
+type Stack struct {
+	mu     sync.Mutex
+	layers map[string]*Layer
+}
+
+func New() *Stack {
+	return &Stack{layers: map[string]*Layer{}}
+}
+
+// Push adds l, replacing any layer from the same source. A zero Pushed
+// is set to now.
+func (s *Stack) Push(l Layer) {
+	if l.Pushed.IsZero() {
+		l.Pushed = time.Now()
+	}
+	s.mu.Lock()
+	s.layers[l.Source] = &l
+	s.mu.Unlock()
+}
+
+// Remove drops the layer of source and reports whether there was one.
+func (s *Stack) Remove(source string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.layers[source]
+	delete(s.layers, source)
+	return ok
+}
+
+// Top returns the layer to show at now, or false if there is none.
+func (s *Stack) Top(now time.Time) (Layer, bool) {
+	layers := s.Layers(now)
+	if len(layers) == 0 {
+		return Layer{}, false
+	}
+	return layers[0], true
+}
+
+// Layers returns copies of the live layers, the one shown first.
+func (s *Stack) Layers(now time.Time) []Layer {
+	s.mu.Lock()
+	out := make([]Layer, 0, len(s.layers))
+	for src, l := range s.layers {
+		if !l.live(now) {
+			delete(s.layers, src)
+			continue
+		}
+		out = append(out, *l)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority > out[j].Priority
+		}
+		return out[i].Pushed.After(out[j].Pushed)
+	})
+	return out
+}
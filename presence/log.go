@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/ipc"
+)
+
+// LogConfig sets how the daemon logs. Logs go to stderr, where journald
+// picks them up.
+type LogConfig struct {
+	// Level is debug, info, warn or error. Payloads are only logged at debug.
+	Level string `json:"level"`
+	// Format is text or json.
+	Format string `json:"format"`
+}
+
+// newLogger builds the logger cfg describes, writing to w.
+func newLogger(cfg LogConfig, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("log level %q: want debug, info, warn or error", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("log format %q: want text or json", cfg.Format)
+}
+
+// setupLogging makes the configured logger the default and hands it to
+// the library packages, which are silent otherwise.
+func setupLogging(cfg LogConfig) error {
+	l, err := newLogger(cfg, os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+	client.SetLogger(l)
+	ipc.SetLogger(l)
+	return nil
+}
@@ -4,18 +4,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"time"
-	"unicode/utf8"
 
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
-	psnet "github.com/shirou/gopsutil/net"
-
-	"example.com/presence/lib/client"
+	"example.com/presence/lib/monitor"
 )
 
 // Configuration
@@ -25,10 +20,11 @@ const (
 	cpuThresholdPct    = 2.0
 	memThresholdPct    = 2.0
 	netThresholdBytes  = 10 * 1024
-	detailsMaxRunes    = 128
 	pasteUploadTimeout = 5 * time.Second
 	reconnectAttempts  = 3
 	reconnectBackoff   = 1 * time.Second
+	requestTimeout     = 5 * time.Second
+	shutdownTimeout    = 3 * time.Second
 )
 
 // RunFastfetch runs fastfetch -l none and returns its output (may be partial on error)
@@ -46,9 +42,9 @@ func RunFastfetch(ctx context.Context) (string, error) {
 }
 
 // ParseFastfetch parses fastfetch output into a map and returns:
-//  - the parsed map
-//  - a concise staticDetails string containing only the requested fields
-//  - a short staticState (user@host or empty)
+//   - the parsed map
+//   - a concise staticDetails string containing only the requested fields
+//   - a short staticState (user@host or empty)
 func ParseFastfetch(output string) (map[string]string, string, string) {
 	lines := strings.Split(output, "\n")
 	m := map[string]string{}
@@ -100,7 +96,7 @@ func ParseFastfetch(output string) (map[string]string, string, string) {
 		parts = append(parts, fmt.Sprintf("Memory: %s", memVal))
 	}
 	staticDetails := strings.Join(parts, "\n")
-	staticDetails = truncateRunes(staticDetails, detailsMaxRunes)
+	staticDetails = monitor.TruncateRunes(staticDetails, monitor.TextMaxRunes)
 
 	staticState := ""
 	if uh, ok := m["UserHost"]; ok {
@@ -110,241 +106,134 @@ func ParseFastfetch(output string) (map[string]string, string, string) {
 	return m, staticDetails, staticState
 }
 
-func truncateRunes(s string, n int) string {
-	if n <= 0 {
-		return ""
-	}
-	if utf8.RuneCountInString(s) <= n {
-		return s
-	}
-	r := []rune(s)
-	if n > 3 {
-		return string(r[:n-3]) + "..."
-	}
-	return string(r[:n])
+// ImageConfig picks the asset keys of the activity images.
+type ImageConfig struct {
+	// Rules pick the large image: the first rule whose fastfetch Module
+	// contains Match, case-insensitively, gives its Key.
+	Rules []ImageRule `json:"rules"`
+	// Large is the large image when no rule matches, Small the small one.
+	Large string `json:"large"`
+	Small string `json:"small"`
 }
 
-// uploadToPasteService uploads text to paste.rs and returns the resulting URL or empty string on failure.
-func uploadToPasteService(text string) string {
-	clientHTTP := &http.Client{Timeout: pasteUploadTimeout}
-	resp, err := clientHTTP.Post("https://paste.rs", "text/plain; charset=utf-8", strings.NewReader(text))
-	if err != nil {
-		fmt.Println("paste upload failed:", err)
-		return ""
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		fmt.Println("paste upload unexpected status:", resp.Status)
-		return ""
-	}
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("paste read failed:", err)
-		return ""
-	}
-	url := strings.TrimSpace(string(b))
-	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		return url
-	}
-	return ""
+type ImageRule struct {
+	Module string `json:"module"`
+	Match  string `json:"match"`
+	Key    string `json:"key"`
 }
 
-func humanBytes(b uint64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
-	}
-	div, exp := uint64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+// defaultImages show the distribution or, failing that, the GPU vendor.
+var defaultImages = ImageConfig{
+	Rules: []ImageRule{
+		{Module: "OS", Match: "arch", Key: "arch"},
+		{Module: "OS", Match: "ubuntu", Key: "ubuntu"},
+		{Module: "GPU", Match: "amd", Key: "radeon"},
+		{Module: "GPU", Match: "radeon", Key: "radeon"},
+		{Module: "GPU", Match: "nvidia", Key: "nvidia"},
+	},
+	Large: "default_os",
+	Small: "dot",
 }
 
-func ptrTime(t time.Time) *time.Time { return &t }
-
-func pickImageKey(m map[string]string) string {
-	if os, ok := m["OS"]; ok {
-		os = strings.ToLower(os)
-		if strings.Contains(os, "arch") {
-			return "arch"
-		}
-		if strings.Contains(os, "ubuntu") {
-			return "ubuntu"
+// pick returns the large image key for the fastfetch modules in m.
+func (c ImageConfig) pick(m map[string]string) string {
+	for _, r := range c.Rules {
+		if v, ok := m[r.Module]; ok && strings.Contains(strings.ToLower(v), strings.ToLower(r.Match)) {
+			return r.Key
 		}
 	}
-	if gpu, ok := m["GPU"]; ok {
-		gpu = strings.ToLower(gpu)
-		if strings.Contains(gpu, "amd") || strings.Contains(gpu, "radeon") {
-			return "radeon"
-		}
-		if strings.Contains(gpu, "nvidia") {
-			return "nvidia"
+	return c.Large
+}
+
+// keys returns every asset key the presence can refer to, for `presence
+// doctor` to check that the application has them all.
+func (c ImageConfig) keys() []string {
+	all := []string{c.Large, c.Small}
+	for _, r := range c.Rules {
+		all = append(all, r.Key)
+	}
+	var keys []string
+	for _, k := range all {
+		if k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
 		}
 	}
-	return "default_os"
+	return keys
 }
 
-// monitorLoop polls CPU/memory/network and updates Discord presence using client.SetActivity.
-// It keeps staticDetails (only OS/Kernel/Packages/CPU/Memory) in Details and
-// uses State/SmallText for dynamic stats.
-func monitorLoop(ctx context.Context, static map[string]string, staticDetails, staticState string) {
-	largeImageKey := pickImageKey(static)
-	largeText := static["DE"]
-	if largeText == "" {
-		largeText = static["WM"]
+// preview prints what would be published: the paste text and the
+// activity fields for one live sample, after redaction. Nothing is sent.
+func preview(cfg Config, static map[string]string, staticDetails string) error {
+	pres, err := newPresenter(cfg, static, staticDetails)
+	if err != nil {
+		return err
 	}
-	smallImageKey := "dot"
-
-	// upload paste for full fastfetch output (optional)
-	pasteURL := ""
-	fullText := staticDetails
-	if d, ok := static["UserHost"]; ok {
-		fullText = d + "\n" + fullText
+	hist, err := openHistory(cfg.History)
+	if err != nil {
+		return err
 	}
-	pasteURL = uploadToPasteService(fullText)
-
-	// initial handshake/login
-	if err := client.Login(clientID); err != nil {
-		fmt.Println("initial Login failed:", err)
-		for i := 0; i < reconnectAttempts; i++ {
-			time.Sleep(reconnectBackoff)
-			if err := client.Login(clientID); err == nil {
-				break
-			} else if i == reconnectAttempts-1 {
-				fmt.Println("could not login after retries:", err)
-				return
-			}
-		}
+	if hist != nil {
+		defer hist.Close()
+	}
+	mon, err := pres.monitor(nil, nil, hist)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	vals, err := pres.liveSample(ctx)
+	if err != nil {
+		return err
+	}
+	if cfg.Paste.Backend != "none" && cfg.ButtonURL == "" {
+		mon.SetButtonURL("<paste url>")
+	}
+	act, err := mon.Render(vals)
+	if err != nil {
+		return err
 	}
-	fmt.Println("Logged in")
-
-	_, _ = cpu.Percent(0, false)
-	prevNet, _ := psnet.IOCounters(false)
-	prevTime := time.Now()
-
-	var lastState string
-
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			client.Logout()
-			return
-		case <-ticker.C:
-			// CPU percent (overall)
-			cpuPctSlice, err := cpu.Percent(0, false)
-			if err != nil || len(cpuPctSlice) == 0 {
-				fmt.Println("cpu read failed:", err)
-				continue
-			}
-			cpuPct := cpuPctSlice[0]
-
-			// Memory
-			vm, err := mem.VirtualMemory()
-			if err != nil {
-				fmt.Println("mem read failed:", err)
-				continue
-			}
-			memPct := vm.UsedPercent
-
-			// Network throughput
-			curNet, _ := psnet.IOCounters(false)
-			now := time.Now()
-			interval := now.Sub(prevTime).Seconds()
-			var rxPerSec, txPerSec float64
-			if len(prevNet) > 0 && len(curNet) > 0 && interval > 0 {
-				rxPerSec = float64(curNet[0].BytesRecv-prevNet[0].BytesRecv) / interval
-				txPerSec = float64(curNet[0].BytesSent-prevNet[0].BytesSent) / interval
-			}
-			prevNet = curNet
-			prevTime = now
-
-			// Build dynamic strings
-			state := fmt.Sprintf("CPU %.0f%% • RAM %.0f%%", cpuPct, memPct)
-			// Put network into Details? user asked to leave rest to stats; we keep Details static only.
-			smallTextNow := fmt.Sprintf("%.0f%% RAM", memPct)
-
-			// thresholding
-			shouldUpdate := false
-			if lastState == "" {
-				shouldUpdate = true
-			} else {
-				var lastCpuPct, lastMemPct float64
-				fmt.Sscanf(lastState, "CPU %f%% • RAM %f%%", &lastCpuPct, &lastMemPct)
-				if absFloat(cpuPct-lastCpuPct) >= cpuThresholdPct || absFloat(memPct-lastMemPct) >= memThresholdPct {
-					shouldUpdate = true
-				} else if (rxPerSec+txPerSec) >= float64(netThresholdBytes) {
-					shouldUpdate = true
-				}
-			}
-
-			if !shouldUpdate {
-				continue
-			}
-
-			// Build activity with only the concise staticDetails in Details
-			act := client.Activity{
-				Details:    staticDetails,
-				State:      state,
-				LargeImage: largeImageKey,
-				LargeText:  largeText,
-				SmallImage: smallImageKey,
-				SmallText:  smallTextNow,
-				Timestamps: &client.Timestamps{Start: ptrTime(time.Now())},
-			}
-			if pasteURL != "" {
-				act.Buttons = []*client.Button{
-					{Label: "Full fastfetch output", Url: pasteURL},
-				}
-			}
 
-			if err := client.SetActivity(act); err != nil {
-				fmt.Println("SetActivity failed:", err)
-				// reconnect and retry once
-				client.Logout()
-				var loginErr error
-				for i := 0; i < reconnectAttempts; i++ {
-					loginErr = client.Login(clientID)
-					if loginErr == nil {
-						break
-					}
-					time.Sleep(reconnectBackoff * time.Duration(i+1))
-				}
-				if loginErr == nil {
-					if retryErr := client.SetActivity(act); retryErr != nil {
-						fmt.Println("SetActivity retry failed:", retryErr)
-					} else {
-						lastState = act.State
-					}
-				} else {
-					fmt.Println("reconnect attempts failed:", loginErr)
-				}
-			} else {
-				lastState = act.State
-			}
+	if cfg.Paste.Backend != "none" {
+		text, err := pres.pasteText(ctx)
+		if err != nil {
+			return err
 		}
-	}
+		fmt.Println("Paste content:")
+		fmt.Println(text)
+		fmt.Println()
+	}
+	fmt.Println("Activity:")
+	for _, f := range []struct{ name, val string }{
+		{"details", act.Details},
+		{"state", act.State},
+		{"large_image", act.LargeImage},
+		{"large_text", act.LargeText},
+		{"small_image", act.SmallImage},
+		{"small_text", act.SmallText},
+	} {
+		fmt.Printf("  %-12s %s\n", f.name+":", f.val)
+	}
+	for _, b := range act.Buttons {
+		fmt.Printf("  %-12s %s -> %s\n", "button:", b.Label, b.Url)
+	}
+	return nil
 }
 
-func absFloat(a float64) float64 {
-	if a < 0 {
-		return -a
+func main() {
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd == "help" {
+		fmt.Print(usage)
+		return
+	}
+	run, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err := run(args); err != nil {
+		fmt.Fprintln(os.Stderr, cmd+":", err)
+		os.Exit(1)
 	}
-	return a
 }
-
-func main() {
-	out, _ := RunFastfetch(context.Background())
-	staticMap, staticDetails, staticState := ParseFastfetch(out)
-
-	// print static details to stdout (optional)
-	fmt.Println("Static details to be used in presence:")
-	fmt.Println(staticDetails)
-
-	ctx := context.Background()
-	monitorLoop(ctx, staticMap, staticDetails, staticState)
-}
\ No newline at end of file
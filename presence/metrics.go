@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/metrics"
+	"example.com/presence/lib/monitor"
+)
+
+// MetricsConfig exposes Prometheus metrics at /metrics.
+type MetricsConfig struct {
+	// Enabled serves them on the control socket.
+	Enabled bool `json:"enabled"`
+	// Listen serves them over TCP as well, e.g. "127.0.0.1:9469", and
+	// implies Enabled.
+	Listen string `json:"listen"`
+}
+
+// daemonMetrics are the instruments the daemon updates as it goes; the
+// gauges are read from the daemon when scraped.
+type daemonMetrics struct {
+	reg              *metrics.Registry
+	setActivity      *metrics.Counter
+	reconnects       *metrics.Counter
+	handshakes       *metrics.Counter
+	handshakeSeconds *metrics.Histogram
+	providerSeconds  *metrics.Histogram
+	providerErrors   *metrics.Counter
+	pasteUploads     *metrics.Counter
+}
+
+func newDaemonMetrics(d *daemon) *daemonMetrics {
+	reg := &metrics.Registry{}
+	m := &daemonMetrics{
+		reg: reg,
+		setActivity: reg.Counter("presence_set_activity_total",
+			"SET_ACTIVITY requests by result: ok, rate_limited or failed.", "result"),
+		reconnects: reg.Counter("presence_reconnects_total",
+			"Reconnects after the connection to Discord was lost, by result.", "result"),
+		handshakes: reg.Counter("presence_handshakes_total",
+			"Handshake attempts by result: ok, rejected or failed.", "result"),
+		handshakeSeconds: reg.Histogram("presence_handshake_duration_seconds",
+			"Time from dialing Discord to its READY event.", nil),
+		providerSeconds: reg.Histogram("presence_provider_duration_seconds",
+			"Time each metric provider takes to sample.", nil, "provider"),
+		providerErrors: reg.Counter("presence_provider_errors_total",
+			"Failed samples by metric provider.", "provider"),
+		pasteUploads: reg.Counter("presence_paste_uploads_total",
+			"Report uploads by result: ok or failed.", "result"),
+	}
+
+	// known label values start at zero, so rates work from the first scrape
+	for c, results := range map[*metrics.Counter][]string{
+		m.setActivity:  {"ok", "rate_limited", "failed"},
+		m.reconnects:   {"ok", "failed"},
+		m.handshakes:   {"ok", "rejected", "failed"},
+		m.pasteUploads: {"ok", "failed"},
+	} {
+		for _, r := range results {
+			c.Add(0, r)
+		}
+	}
+	for _, p := range []string{"cpu", "memory", "network"} {
+		m.providerErrors.Add(0, p)
+	}
+
+	gauge := func(name, help string, f func() (float64, bool)) {
+		reg.GaugeFunc(name, help, func() []metrics.Sample {
+			if v, ok := f(); ok {
+				return []metrics.Sample{{Value: v}}
+			}
+			return nil
+		})
+	}
+	gauge("presence_discord_connected", "1 while connected to Discord.", func() (float64, bool) {
+		return boolValue(d.Status().Connected), true
+	})
+	gauge("presence_paused", "1 while updates are paused.", func() (float64, bool) {
+		return boolValue(d.Status().Paused), true
+	})
+	gauge("presence_last_update_timestamp_seconds", "When Discord last accepted an activity.", func() (float64, bool) {
+		return unixSeconds(d.Status().LastUpdate)
+	})
+	gauge("presence_paste_deletions_pending", "Superseded pastes still to be deleted.", func() (float64, bool) {
+		if d.pasteCache == nil {
+			return 0, false
+		}
+		return float64(d.pasteCache.Pending()), true
+	})
+	gauge("presence_sample_timestamp_seconds", "When the metrics below were sampled.", func() (float64, bool) {
+		return unixSeconds(d.monitor().Snapshot().Sampled)
+	})
+	gauge("presence_cpu_usage_percent", "Last sampled CPU usage, smoothed.", func() (float64, bool) {
+		v, ok := d.monitor().Snapshot().Values[monitor.MetricCPU]
+		return v, ok
+	})
+	gauge("presence_memory_used_percent", "Last sampled memory usage, smoothed.", func() (float64, bool) {
+		v, ok := d.monitor().Snapshot().Values[monitor.MetricRAM]
+		return v, ok
+	})
+	for _, dir := range []struct{ name, metric string }{
+		{"presence_network_receive_bytes_per_second", monitor.MetricNetRx},
+		{"presence_network_transmit_bytes_per_second", monitor.MetricNetTx},
+	} {
+		reg.GaugeFunc(dir.name, "Last sampled throughput of each selected interface, smoothed.", func() []metrics.Sample {
+			var samples []metrics.Sample
+			for k, v := range d.monitor().Snapshot().Values {
+				if iface, ok := strings.CutPrefix(k, dir.metric+"."); ok {
+					samples = append(samples, metrics.Sample{LabelValues: []string{iface}, Value: v})
+				}
+			}
+			return samples
+		}, "interface")
+	}
+	return m
+}
+
+// countSetActivity records the outcome of one SET_ACTIVITY request.
+func (m *daemonMetrics) countSetActivity(err error) {
+	switch {
+	case err == nil:
+		m.setActivity.Inc("ok")
+	case errors.Is(err, client.ErrRateLimited):
+		m.setActivity.Inc("rate_limited")
+	default:
+		m.setActivity.Inc("failed")
+	}
+}
+
+// countHandshake records one login attempt that started at start.
+func (m *daemonMetrics) countHandshake(start time.Time, err error) {
+	switch {
+	case err == nil:
+		m.handshakes.Inc("ok")
+		m.handshakeSeconds.Observe(time.Since(start).Seconds())
+	case errors.Is(err, client.ErrHandshakeRejected):
+		m.handshakes.Inc("rejected")
+	default:
+		m.handshakes.Inc("failed")
+	}
+}
+
+// instrument times every sample of p and counts its failures.
+func (m *daemonMetrics) instrument(name string, p monitor.Provider) monitor.Provider {
+	return monitor.ProviderFunc(func(ctx context.Context) (map[string]float64, error) {
+		start := time.Now()
+		vals, err := p.Sample(ctx)
+		m.providerSeconds.Observe(time.Since(start).Seconds(), name)
+		if err != nil {
+			m.providerErrors.Inc(name)
+		}
+		return vals, err
+	})
+}
+
+// serveMetrics serves /metrics alone on ln until ln is closed.
+func serveMetrics(ln net.Listener, h http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", h)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("metrics listener failed", "err", err)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixSeconds(t time.Time) (float64, bool) {
+	if t.IsZero() {
+		return 0, false
+	}
+	return float64(t.UnixNano()) / 1e9, true
+}
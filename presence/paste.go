@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/presence/lib/paste"
+)
+
+// PasteConfig selects where the fastfetch report is uploaded.
+//
+// Backend is one of:
+//   - "paste.rs" (default), "0x0": the public services; Endpoint overrides the URL
+//   - "http": any endpoint, see Method, Headers, Field, the Response* fields and DeleteMethod
+//   - "local": write into Dir, published by some web server under URLPrefix
+//   - "standin": an in-process paste.rs look-alike on Endpoint (default 127.0.0.1:0), for offline testing; never cached
+//   - "none": no upload and no button
+type PasteConfig struct {
+	Backend        string            `json:"backend"`
+	Endpoint       string            `json:"endpoint"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	Field          string            `json:"field"`
+	ResponseJSON   string            `json:"response_json"`
+	ResponseHeader string            `json:"response_header"`
+	DeleteMethod   string            `json:"delete_method"`
+	Dir            string            `json:"dir"`
+	URLPrefix      string            `json:"url_prefix"`
+	Timeout        Duration          `json:"timeout"` // per upload
+}
+
+// newUploader builds the configured backend. It returns a nil Uploader
+// when uploads are disabled.
+func newUploader(cfg PasteConfig) (paste.Uploader, error) {
+	switch cfg.Backend {
+	case "", "paste.rs":
+		return &paste.PasteRS{Endpoint: cfg.Endpoint}, nil
+	case "0x0":
+		return &paste.ZeroXZero{Endpoint: cfg.Endpoint}, nil
+	case "http":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("paste backend http needs an endpoint")
+		}
+		return &paste.HTTP{
+			URL:            cfg.Endpoint,
+			Method:         cfg.Method,
+			Headers:        cfg.Headers,
+			Field:          cfg.Field,
+			ResponseJSON:   cfg.ResponseJSON,
+			ResponseHeader: cfg.ResponseHeader,
+			DeleteMethod:   cfg.DeleteMethod,
+		}, nil
+	case "local":
+		if cfg.Dir == "" || cfg.URLPrefix == "" {
+			return nil, fmt.Errorf("paste backend local needs dir and url_prefix")
+		}
+		return &paste.LocalDir{Dir: cfg.Dir, URLPrefix: cfg.URLPrefix}, nil
+	case "standin":
+		addr := cfg.Endpoint
+		if addr == "" {
+			addr = "127.0.0.1:0"
+		}
+		s, err := paste.StartStandIn(addr)
+		if err != nil {
+			return nil, fmt.Errorf("start paste stand-in: %w", err)
+		}
+		return &paste.PasteRS{Endpoint: s.URL()}, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown paste backend %q", cfg.Backend)
+}
+
+// newPasteCache wraps the configured backend in an on-disk cache, so an
+// unchanged report is not uploaded again on every start. It returns nil
+// when uploads are disabled.
+func newPasteCache(cfg PasteConfig) (*paste.Cache, error) {
+	up, err := newUploader(cfg)
+	if up == nil || err != nil {
+		return nil, err
+	}
+	backend := cfg.Backend
+	if backend == "" {
+		backend = "paste.rs"
+	}
+	if cfg.Endpoint != "" {
+		backend += " " + cfg.Endpoint
+	}
+	path := ""
+	switch dir, err := os.UserCacheDir(); {
+	case cfg.Backend == "standin":
+		// its pastes live in memory and its port changes on every start,
+		// so a cached URL would never resolve again
+	case err != nil:
+		slog.Warn("paste cache disabled", "err", err)
+	default:
+		path = filepath.Join(dir, "presence", "paste.json")
+	}
+	return &paste.Cache{Uploader: up, Backend: backend, Path: path}, nil
+}
+
+// uploadReport uploads text, reusing the cached paste when the text is
+// unchanged, and returns the confirmed URL or empty string on failure.
+func uploadReport(ctx context.Context, pc *paste.Cache, timeout time.Duration, text string) string {
+	if pc == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	url, err := pc.Upload(ctx, text)
+	if err != nil {
+		slog.Warn("paste upload failed", "err", err)
+	}
+	return url
+}
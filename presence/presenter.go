@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/history"
+	"example.com/presence/lib/monitor"
+	"example.com/presence/lib/redact"
+)
+
+// presenter holds what the monitor renders from, the static fastfetch
+// data and the page templates, and redacts the activity and paste text
+// before they leave the machine.
+type presenter struct {
+	cfg           Config
+	static        map[string]string
+	staticDetails string
+	pages         map[string]monitor.Templates
+	redactor      *redact.Redactor
+}
+
+func newPresenter(cfg Config, static map[string]string, staticDetails string) (*presenter, error) {
+	pages := map[string]monitor.Templates{defaultPage: cfg.Templates}
+	for name, t := range cfg.Pages {
+		if name == defaultPage {
+			return nil, fmt.Errorf("page name %q is reserved for the top-level templates", name)
+		}
+		pages[name] = t.WithDefaults(cfg.Templates)
+	}
+	if cfg.Idle.After > 0 && cfg.Idle.Action == "page" {
+		if _, ok := pages[cfg.Idle.Page]; !ok {
+			if cfg.Idle.Page != awayPage {
+				return nil, fmt.Errorf("idle page %q is not defined in pages", cfg.Idle.Page)
+			}
+			pages[awayPage] = awayTemplates.WithDefaults(cfg.Templates)
+		}
+	}
+	for i, e := range cfg.Schedule.Entries {
+		if _, ok := pages[e.Page]; e.Page != "" && !ok {
+			return nil, fmt.Errorf("schedule entry %d: page %q is not defined in pages", i+1, e.Page)
+		}
+	}
+	// parse every page now, so switching pages later cannot fail
+	for name, t := range pages {
+		if _, err := monitor.ParseTemplates(t); err != nil {
+			if name == defaultPage {
+				return nil, err
+			}
+			return nil, fmt.Errorf("page %s: %w", name, err)
+		}
+	}
+	red, err := newRedactor(cfg.Redact)
+	if err != nil {
+		return nil, err
+	}
+	return &presenter{
+		cfg:           cfg,
+		static:        static,
+		staticDetails: staticDetails,
+		pages:         pages,
+		redactor:      red,
+	}, nil
+}
+
+func (p *presenter) hasPage(name string) bool {
+	_, ok := p.pages[name]
+	return ok
+}
+
+// pageNames returns the page names in sorted order.
+func (p *presenter) pageNames() []string {
+	names := make([]string, 0, len(p.pages))
+	for name := range p.pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// monitor returns a monitor for the default page that publishes to c,
+// recording provider timings in m unless it is nil.
+func (p *presenter) monitor(c monitor.Client, m *daemonMetrics, h *history.Store) (*monitor.Monitor, error) {
+	providers := p.providers()
+	if m != nil {
+		for i, name := range p.providerNames() {
+			providers[i] = m.instrument(name, providers[i])
+		}
+	}
+	cfg := monitor.Config{
+		Client:        c,
+		Providers:     providers,
+		Templates:     p.pages[defaultPage],
+		Thresholds:    p.cfg.Thresholds,
+		Smoothing:     p.cfg.Smoothing,
+		Interval:      time.Duration(p.cfg.PollInterval),
+		SeriesLen:     p.cfg.SeriesLen,
+		Static:        p.static,
+		StaticDetails: p.staticDetails,
+		LargeImage:    p.cfg.Images.pick(p.static),
+		SmallImage:    p.cfg.Images.Small,
+		ButtonURL:     p.cfg.ButtonURL,
+		Transform: func(act *client.Activity) {
+			redactActivity(p.redactor, act)
+		},
+		Logger: slog.Default(),
+	}
+	if h != nil {
+		cfg.History = h
+	}
+	return monitor.New(cfg)
+}
+
+// providerNames returns the configured providers, all of them if unset.
+func (p *presenter) providerNames() []string {
+	if p.cfg.Providers == nil {
+		return providerNames
+	}
+	return p.cfg.Providers
+}
+
+// providers returns new providers in the order of providerNames.
+func (p *presenter) providers() []monitor.Provider {
+	var providers []monitor.Provider
+	for _, name := range p.providerNames() {
+		switch name {
+		case "cpu":
+			providers = append(providers, monitor.CPU())
+		case "memory":
+			providers = append(providers, monitor.Memory())
+		case "network":
+			providers = append(providers, monitor.Network(p.cfg.Network))
+		}
+	}
+	return providers
+}
+
+// liveSample measures the metrics over one second.
+func (p *presenter) liveSample(ctx context.Context) (map[string]float64, error) {
+	providers := p.providers()
+	time.Sleep(time.Second)
+	return monitor.Collect(ctx, providers)
+}
+
+// pasteText is the redacted report uploaded for the report button: every
+// fastfetch module, plus a live metrics snapshot when configured.
+func (p *presenter) pasteText(ctx context.Context) (string, error) {
+	var vals map[string]float64
+	if p.cfg.Report.LiveMetrics {
+		v, err := p.liveSample(ctx)
+		if err != nil {
+			return "", err
+		}
+		vals = v
+	}
+	text, err := renderReport(p.cfg.Report, p.static, vals)
+	if err != nil {
+		return "", err
+	}
+	return p.redactor.String(text), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/control"
+	"example.com/presence/lib/monitor"
+)
+
+// ProfileConfig is a named look the daemon can switch to. Whatever a
+// profile sets replaces the top-level setting; the rest is inherited.
+type ProfileConfig struct {
+	// ClientID names another Discord application, whose name shows as
+	// "Playing ..."; switching to it reconnects.
+	ClientID string `json:"client_id"`
+	// Templates fields left empty come from the top-level templates.
+	Templates monitor.Templates `json:"templates"`
+	// Pages replace the top-level pages when set.
+	Pages map[string]monitor.Templates `json:"pages"`
+	// Images fields left empty come from the top-level images.
+	Images ImageConfig `json:"images"`
+	// ButtonURL replaces the link to the uploaded report, ButtonLabel
+	// the label of the button, templates.button, so the two can change
+	// together.
+	ButtonURL   string   `json:"button_url"`
+	ButtonLabel string   `json:"button_label"`
+	Providers   []string `json:"providers"`
+	// Thresholds are merged into the top-level ones by metric.
+	Thresholds map[string]monitor.Threshold `json:"thresholds"`
+}
+
+// defaultProfile names the top-level settings.
+const defaultProfile = "default"
+
+// providerNames are the metric providers a config can choose from.
+var providerNames = []string{"cpu", "memory", "network"}
+
+// profileNames returns the profile names in sorted order.
+func (c Config) profileNames() []string {
+	names := []string{defaultProfile}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withProfile returns the settings of the named profile.
+func (c Config) withProfile(name string) (Config, error) {
+	if name == defaultProfile {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return c, fmt.Errorf("unknown profile %q (have %v)", name, c.profileNames())
+	}
+	c.ClientID = firstNonEmpty(p.ClientID, c.ClientID)
+	c.Templates = p.Templates.WithDefaults(c.Templates)
+	if p.Pages != nil {
+		c.Pages = p.Pages
+	}
+	if p.Images.Rules != nil {
+		c.Images.Rules = p.Images.Rules
+	}
+	c.Images.Large = firstNonEmpty(p.Images.Large, c.Images.Large)
+	c.Images.Small = firstNonEmpty(p.Images.Small, c.Images.Small)
+	c.ButtonURL = firstNonEmpty(p.ButtonURL, c.ButtonURL)
+	c.Templates.Button = firstNonEmpty(p.ButtonLabel, c.Templates.Button)
+	if p.Providers != nil {
+		c.Providers = p.Providers
+	}
+	if p.Thresholds != nil {
+		c.Thresholds = maps.Clone(c.Thresholds)
+		if c.Thresholds == nil {
+			c.Thresholds = map[string]monitor.Threshold{}
+		}
+		maps.Copy(c.Thresholds, p.Thresholds)
+	}
+	return c, nil
+}
+
+// validateProfiles checks what loadConfig can check without fastfetch
+// data; the templates are parsed when a presenter is built.
+func (c Config) validateProfiles() error {
+	if _, ok := c.Profiles[defaultProfile]; ok {
+		return fmt.Errorf("profile name %q is reserved for the top-level settings", defaultProfile)
+	}
+	for i, e := range c.Schedule.Entries {
+		if _, ok := c.Profiles[e.Profile]; e.Profile != "" && e.Profile != defaultProfile && !ok {
+			return fmt.Errorf("schedule entry %d: unknown profile %q", i+1, e.Profile)
+		}
+	}
+	for _, name := range c.profileNames() {
+		p, _ := c.withProfile(name)
+		for _, prov := range p.Providers {
+			if !slices.Contains(providerNames, prov) {
+				return fmt.Errorf("profile %s: unknown provider %q (want %v)", name, prov, providerNames)
+			}
+		}
+	}
+	return nil
+}
+
+// SetProfile implements control.Controller. The new profile's monitor
+// takes over at once, on the same page if the profile has it; its first
+// sample replaces the old activity. A different client ID moves the
+// presence to the other application, in the loop.
+func (d *daemon) SetProfile(name string) error {
+	cfg, err := d.cfg.withProfile(name)
+	if err != nil {
+		return control.Invalidf("%v", err)
+	}
+	d.mu.Lock()
+	static, staticDetails := d.pres.static, d.pres.staticDetails
+	d.mu.Unlock()
+	pres, err := newPresenter(cfg, static, staticDetails)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	mon, err := pres.monitor(monitorLayer{d}, d.metrics, d.history)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !pres.hasPage(d.page) {
+		d.page = defaultPage
+	}
+	shown := d.page
+	if d.away && d.cfg.Idle.Action == "page" {
+		shown = d.cfg.Idle.Page
+	}
+	if err := mon.SetTemplates(pres.pages[shown]); err != nil {
+		return err
+	}
+	if cfg.ButtonURL == "" {
+		mon.SetButtonURL(d.pasteURL)
+	}
+	if d.stopMon != nil {
+		d.stopMon()
+	}
+	switched := cfg.ClientID != d.clientID
+	d.profile, d.clientID, d.pres, d.mon = name, cfg.ClientID, pres, mon
+	if switched && d.connected {
+		select {
+		case d.relogin <- struct{}{}:
+		default:
+		}
+	}
+	slog.Info("profile switched", "profile", name)
+	return nil
+}
+
+// runMonitors runs the monitor of the current profile until ctx is done.
+// SetProfile stops it, and the next one starts.
+func (d *daemon) runMonitors(ctx context.Context) {
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		mon := d.mon
+		monCtx, cancel := context.WithCancel(ctx)
+		d.stopMon = cancel
+		d.mu.Unlock()
+		mon.Run(monCtx)
+		cancel()
+	}
+}
+
+// reconnect moves the presence to the application of the current client
+// ID: the old connection is cleared and closed, then the new one made.
+// The old stats would show under the new name, so they go until the new
+// monitor's first sample.
+func (d *daemon) reconnect(ctx context.Context) {
+	d.pubMu.Lock()
+	defer d.pubMu.Unlock()
+	d.stack.Remove(monitorSource)
+	closeCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	if err := client.Shutdown(closeCtx); err != nil {
+		slog.Warn("clearing presence failed", "err", err)
+	}
+	cancel()
+	d.mu.Lock()
+	d.connected = false
+	d.lastSent, d.cleared = nil, true
+	d.mu.Unlock()
+	if err := d.login(ctx); err != nil {
+		// the next send tries again
+		slog.Error("login with the new client ID failed", "err", err)
+		d.setError(err)
+		return
+	}
+	slog.Info("logged in", "client_id", d.currentClientID())
+	d.poke()
+}
+
+// monitor returns the monitor of the current profile.
+func (d *daemon) monitor() *monitor.Monitor {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.mon
+}
+
+func (d *daemon) currentClientID() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clientID
+}
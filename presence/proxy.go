@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"example.com/presence/lib/ipc"
+	"example.com/presence/lib/proxy"
+)
+
+// ProxyConfig configures `presence proxy`. Socket numbers are the N of
+// discord-ipc-N; point the local apps at Listen.
+type ProxyConfig struct {
+	Listen   int `json:"listen"`
+	Upstream int `json:"upstream"`
+	// Policy is priority, latest or merge.
+	Policy string `json:"policy"`
+	// Priorities ranks apps by the client ID they handshake with.
+	Priorities map[string]int `json:"priorities"`
+}
+
+const (
+	proxyListen   = 5
+	proxyUpstream = 0
+)
+
+// newProxy builds the proxy for cfg, connecting upstream as the
+// configured client ID.
+func newProxy(cfg Config) (*proxy.Proxy, error) {
+	if cfg.Proxy.Listen == cfg.Proxy.Upstream {
+		return nil, fmt.Errorf("proxy: listen and upstream are both discord-ipc-%d", cfg.Proxy.Listen)
+	}
+	policy, err := proxy.ParsePolicy(cfg.Proxy.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	upstream := cfg.Proxy.Upstream
+	return &proxy.Proxy{
+		ClientID:     cfg.ClientID,
+		Policy:       policy,
+		Priorities:   cfg.Proxy.Priorities,
+		Dial:         func() (net.Conn, error) { return ipc.Dial(context.Background(), upstream) },
+		Logger:       slog.Default(),
+		MaxFrameSize: cfg.MaxFrameSize,
+	}, nil
+}
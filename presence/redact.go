@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"example.com/presence/lib/client"
+	"example.com/presence/lib/redact"
+)
+
+// RedactConfig controls what is scrubbed from the paste and from every
+// activity field before either is published. Builtins names rules from
+// redact.Builtins; Rules are applied after them.
+type RedactConfig struct {
+	Builtins []string     `json:"builtins"`
+	Rules    []RedactRule `json:"rules"`
+}
+
+// RedactRule is a custom regexp rule; Replace may use ${1} style submatches.
+type RedactRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+func newRedactor(cfg RedactConfig) (*redact.Redactor, error) {
+	extra := make([]redact.Rule, 0, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %d: %w", i, err)
+		}
+		extra = append(extra, redact.Rule{Name: fmt.Sprintf("rule %d", i), Pattern: re, Replace: r.Replace})
+	}
+	return redact.New(cfg.Builtins, extra)
+}
+
+// redactActivity scrubs every text field of act in place.
+func redactActivity(r *redact.Redactor, act *client.Activity) {
+	for _, f := range []*string{&act.Details, &act.State, &act.LargeText, &act.SmallText} {
+		*f = r.String(*f)
+	}
+	for _, b := range act.Buttons {
+		b.Label = r.String(b.Label)
+	}
+}
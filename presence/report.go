@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"example.com/presence/lib/monitor"
+)
+
+// ReportConfig shapes the report behind the button.
+type ReportConfig struct {
+	// Format is "markdown" (default) or "html".
+	Format string `json:"format"`
+	// LiveMetrics adds a snapshot of CPU/RAM/network taken at upload time.
+	LiveMetrics bool `json:"live_metrics"`
+	// Template replaces the built-in layout. It is a text/template for
+	// markdown and an html/template for html, executed against reportData.
+	Template string `json:"template"`
+}
+
+// reportSections groups fastfetch modules by the name before any
+// " (detail)" or trailing index, e.g. "Disk (/)" and "GPU 2" fall under
+// Disk and GPU. Anything not listed goes to Other, sorted by name.
+var reportSections = []struct {
+	name    string
+	modules []string
+}{
+	{"System", []string{"OS", "Host", "Kernel", "Uptime", "Packages", "Shell", "Init System", "Locale"}},
+	{"Desktop", []string{"Display", "DE", "WM", "WM Theme", "Theme", "Icons", "Font", "Cursor", "Terminal", "Terminal Font"}},
+	{"Hardware", []string{"Board", "BIOS", "CPU", "GPU", "Memory", "Swap", "Disk", "Battery", "Power Adapter"}},
+	{"Network", []string{"Local IP", "Public IP", "Wifi", "DNS"}},
+}
+
+type reportItem struct {
+	Key, Value string
+}
+
+type reportSection struct {
+	Name  string
+	Items []reportItem
+}
+
+// reportData is what the report template sees.
+type reportData struct {
+	Title    string
+	Sections []reportSection
+	// Metrics is nil unless live metrics are enabled.
+	Metrics   *monitor.Data
+	Generated time.Time
+}
+
+// moduleBase strips " (detail)" and a trailing index from a module name.
+func moduleBase(key string) string {
+	base, _, _ := strings.Cut(key, " (")
+	if i := strings.LastIndexByte(base, ' '); i != -1 && strings.Trim(base[i+1:], "0123456789") == "" {
+		base = base[:i]
+	}
+	return base
+}
+
+// buildReportSections sorts every parsed fastfetch module into a section.
+func buildReportSections(m map[string]string) []reportSection {
+	index := map[string]int{}
+	for i, s := range reportSections {
+		for j, mod := range s.modules {
+			index[mod] = i*100 + j
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != "UserHost" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	// listed modules keep the section order, Disk (/) before Disk (/home)
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, okA := index[moduleBase(keys[i])]
+		b, okB := index[moduleBase(keys[j])]
+		if okA && okB {
+			return a < b
+		}
+		return okA && !okB
+	})
+
+	sections := make([]reportSection, len(reportSections)+1)
+	for i, s := range reportSections {
+		sections[i].Name = s.name
+	}
+	sections[len(reportSections)].Name = "Other"
+	for _, k := range keys {
+		si := len(reportSections)
+		if pos, ok := index[moduleBase(k)]; ok {
+			si = pos / 100
+		}
+		sections[si].Items = append(sections[si].Items, reportItem{Key: k, Value: m[k]})
+	}
+
+	out := sections[:0]
+	for _, s := range sections {
+		if len(s.Items) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+const markdownReport = `# {{if .Title}}{{.Title}}{{else}}System report{{end}}
+{{range .Sections}}
+## {{.Name}}
+
+| Module | Value |
+| --- | --- |
+{{range .Items}}| {{md .Key}} | {{md .Value}} |
+{{end}}{{end}}{{with .Metrics}}
+## Live metrics
+
+- CPU: {{printf "%.0f" .CPU}}%
+- RAM: {{printf "%.0f" .RAM}}%
+- Network: ↓ {{.Net.RxRate}} ↑ {{.Net.TxRate}}
+{{range $name, $n := .Ifaces}}  - {{$name}}: ↓ {{$n.RxRate}} ↑ {{$n.TxRate}}
+{{end}}{{end}}{{if .Metrics}}
+_Generated {{.Generated.Format "2006-01-02 15:04 MST"}}_
+{{end}}`
+
+const htmlReport = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{if .Title}}{{.Title}}{{else}}System report{{end}}</title></head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}System report{{end}}</h1>
+{{range .Sections}}<h2>{{.Name}}</h2>
+<table>
+{{range .Items}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Metrics}}<h2>Live metrics</h2>
+<ul>
+<li>CPU: {{printf "%.0f" .CPU}}%</li>
+<li>RAM: {{printf "%.0f" .RAM}}%</li>
+<li>Network: ↓ {{.Net.RxRate}} ↑ {{.Net.TxRate}}</li>
+{{range $name, $n := .Ifaces}}<li>{{$name}}: ↓ {{$n.RxRate}} ↑ {{$n.TxRate}}</li>
+{{end}}</ul>
+{{end}}{{if .Metrics}}<p><em>Generated {{.Generated.Format "2006-01-02 15:04 MST"}}</em></p>
+{{end}}</body></html>
+`
+
+// markdownEscape keeps values from breaking out of a table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// parse returns the report template for the configured format, so that
+// loadConfig can reject a bad one before anything is uploaded.
+func (c ReportConfig) parse() (interface {
+	Execute(w io.Writer, data any) error
+}, error) {
+	switch c.Format {
+	case "", "markdown":
+		src := c.Template
+		if src == "" {
+			src = markdownReport
+		}
+		t, err := template.New("report").Funcs(monitor.Funcs).Funcs(template.FuncMap{"md": markdownEscape}).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("report template: %w", err)
+		}
+		return t, nil
+	case "html":
+		src := c.Template
+		if src == "" {
+			src = htmlReport
+		}
+		t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap(monitor.Funcs)).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("report template: %w", err)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown report format %q (want markdown or html)", c.Format)
+}
+
+// renderReport builds the full report from every parsed fastfetch module.
+// vals is the live metrics snapshot, or nil.
+func renderReport(cfg ReportConfig, static map[string]string, vals map[string]float64) (string, error) {
+	data := reportData{
+		Title:     static["UserHost"],
+		Sections:  buildReportSections(static),
+		Generated: time.Now(),
+	}
+	if vals != nil {
+		d := monitor.NewData(vals, static, "")
+		data.Metrics = &d
+	}
+
+	t, err := cfg.parse()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"example.com/presence/lib/control"
+)
+
+// runtimeDir is where the daemon keeps its per-session state.
+func runtimeDir() string {
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "presence")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("presence-%d", os.Getuid()))
+}
+
+// controlPath is the unix socket of the control API.
+func controlPath() string { return filepath.Join(runtimeDir(), "control.sock") }
+
+func listenControl() (net.Listener, error) {
+	if err := os.MkdirAll(runtimeDir(), 0o700); err != nil {
+		return nil, err
+	}
+	return control.Listen(controlPath())
+}
+
+// errAlreadyRunning is returned by lockInstance while another daemon
+// holds the lock.
+var errAlreadyRunning = errors.New("the daemon is already running")
+
+// lockPath is the single-instance lock, holding the PID of its owner.
+func lockPath() string { return filepath.Join(runtimeDir(), "daemon.lock") }
+
+// lockInstance takes the single-instance lock, so that two daemons do not
+// fight over the presence. The lock goes away with the process; a daemon
+// that crashed never leaves it stale.
+func lockInstance() (release func(), err error) {
+	if err := os.MkdirAll(runtimeDir(), 0o700); err != nil {
+		return nil, err
+	}
+	f, held, err := openLock(lockPath())
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", lockPath(), err)
+	}
+	if held {
+		return nil, errAlreadyRunning
+	}
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	// the file stays: removing it would race with a daemon that has
+	// opened it but not locked it yet
+	return func() { f.Close() }, nil
+}
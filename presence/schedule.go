@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"example.com/presence/lib/schedule"
+	"example.com/presence/lib/stack"
+)
+
+// ScheduleConfig switches profiles or pages, or clears the presence, by
+// time of day.
+type ScheduleConfig struct {
+	// Timezone is an IANA name like "Europe/Berlin"; empty means the
+	// local time zone.
+	Timezone string          `json:"timezone"`
+	Entries  []ScheduleEntry `json:"entries"`
+}
+
+// ScheduleEntry applies from From to To, "HH:MM", on Days: "mon-fri",
+// "sat,sun", "weekdays", "weekends" or "daily", the default. A range that
+// ends before it starts runs overnight. Where entries overlap, the first
+// one wins.
+type ScheduleEntry struct {
+	Days string `json:"days"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Profile or Page is used during the range; Clear clears the
+	// presence instead.
+	Profile string `json:"profile"`
+	Page    string `json:"page"`
+	Clear   bool   `json:"clear"`
+}
+
+const (
+	// scheduleSource is the stack layer of entries that clear the
+	// presence: above overrides at the default priority, below idle.
+	scheduleSource   = "schedule"
+	schedulePriority = 500
+	// scheduleRecheck bounds the wait for the next boundary, so a clock
+	// change or a suspend does not leave the schedule behind for long.
+	scheduleRecheck = time.Minute
+)
+
+// compile parses the schedule; it returns nil if there are no entries.
+func (c ScheduleConfig) compile() (*schedule.Schedule, error) {
+	if len(c.Entries) == 0 {
+		return nil, nil
+	}
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, fmt.Errorf("schedule timezone: %w", err)
+		}
+	}
+	s := &schedule.Schedule{Loc: loc}
+	for i, e := range c.Entries {
+		set := 0
+		for _, ok := range []bool{e.Profile != "", e.Page != "", e.Clear} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("schedule entry %d: set one of profile, page or clear", i+1)
+		}
+		days, err := schedule.ParseDays(e.Days)
+		if err != nil {
+			return nil, fmt.Errorf("schedule entry %d: %w", i+1, err)
+		}
+		from, err := schedule.ParseClock(e.From)
+		if err != nil {
+			return nil, fmt.Errorf("schedule entry %d: from: %w", i+1, err)
+		}
+		to, err := schedule.ParseClock(e.To)
+		if err != nil {
+			return nil, fmt.Errorf("schedule entry %d: to: %w", i+1, err)
+		}
+		s.Ranges = append(s.Ranges, schedule.Range{Days: days, From: from, To: to})
+	}
+	return s, nil
+}
+
+// runSchedule applies the entry in effect until ctx is done, waking at
+// each boundary rather than at the next sample. The profile or page in
+// use before an entry switched it comes back when no entry does.
+func (d *daemon) runSchedule(ctx context.Context, s *schedule.Schedule) {
+	current := -1
+	restoreProfile, restorePage := "", ""
+	apply := func(i int) {
+		var e ScheduleEntry
+		if i >= 0 {
+			e = d.cfg.Schedule.Entries[i]
+			slog.Info("schedule entry begins", "entry", i+1, "profile", e.Profile, "page", e.Page, "clear", e.Clear)
+		} else {
+			slog.Info("schedule entry ends", "entry", current+1)
+		}
+		if e.Clear {
+			d.stack.Push(stack.Layer{Source: scheduleSource, Priority: schedulePriority})
+		} else {
+			d.stack.Remove(scheduleSource)
+		}
+		profile := e.Profile
+		if profile != "" && restoreProfile == "" {
+			d.mu.Lock()
+			restoreProfile = d.profile
+			d.mu.Unlock()
+		} else if profile == "" && restoreProfile != "" {
+			profile, restoreProfile = restoreProfile, ""
+		}
+		if profile != "" {
+			if err := d.SetProfile(profile); err != nil {
+				slog.Error("schedule could not switch profile", "profile", profile, "err", err)
+			}
+		}
+		page := e.Page
+		if page != "" && restorePage == "" {
+			d.mu.Lock()
+			restorePage = d.page
+			d.mu.Unlock()
+		} else if page == "" && restorePage != "" {
+			page, restorePage = restorePage, ""
+		}
+		if page != "" {
+			if err := d.SetPage(page); err != nil {
+				slog.Error("schedule could not switch page", "page", page, "err", err)
+			}
+		}
+		d.poke()
+	}
+	for {
+		now := time.Now()
+		if i := s.At(now); i != current {
+			apply(i)
+			current = i
+		}
+		wait := scheduleRecheck
+		if next := s.Next(now); !next.IsZero() {
+			wait = min(next.Sub(now), wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unitWatchdog is the WatchdogSec of the generated unit. It has to cover
+// a full round of reconnect attempts, about 40s, during which the main
+// loop does not answer the watchdog.
+const unitWatchdog = "60s"
+
+// unitFile returns a systemd user unit that runs exe with args.
+func unitFile(exe string, args []string) string {
+	cmd := []string{systemdQuote(exe)}
+	for _, a := range args {
+		cmd = append(cmd, systemdQuote(a))
+	}
+	return `[Unit]
+Description=Discord presence with live system stats
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart=` + strings.Join(cmd, " ") + `
+Restart=on-failure
+RestartSec=5s
+WatchdogSec=` + unitWatchdog + `
+
+[Install]
+WantedBy=graphical-session.target
+`
+}
+
+// systemdQuote quotes s for an ExecStart= line: specifiers are escaped,
+// and words with spaces, quotes or backslashes are double-quoted.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func cmdUnit(args []string) error {
+	fs, configPath := newFlagSet("unit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: presence unit [flags]")
+		fmt.Fprintln(fs.Output(), "\nPrints a systemd user unit that runs the daemon with readiness and")
+		fmt.Fprintln(fs.Output(), "watchdog notifications, or writes it with -o.")
+		fs.PrintDefaults()
+	}
+	out := fs.String("o", "", "write the unit to this file instead of stdout")
+	install := fs.Bool("install", false, "write the unit to the systemd user unit directory")
+	fs.Parse(args)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	runArgs := []string{"run"}
+	if *configPath != defaultConfigPath() {
+		abs, err := filepath.Abs(*configPath)
+		if err != nil {
+			return err
+		}
+		runArgs = append(runArgs, "-config", abs)
+	}
+	unit := unitFile(exe, runArgs)
+
+	path := *out
+	if *install {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, "systemd", "user", "presence.service")
+	}
+	if path == "" {
+		fmt.Print(unit)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "wrote", path)
+	if *install {
+		fmt.Fprintln(os.Stderr, "enable it with: systemctl --user daemon-reload && systemctl --user enable --now presence")
+	}
+	return nil
+}